@@ -0,0 +1,137 @@
+package command
+
+import (
+	"fmt"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+// maxAdminsNamed is how many administrators a denial names before summarising the rest.
+const maxAdminsNamed = 5
+
+// checkPermission returns the response to send when the sender isn't in any of
+// the groups in p, or an empty string when they may carry on.
+func checkPermission(ctx context.Context, sender string, p *permissions) string {
+	canPerform, err := p.CanPerform(ctx, sender)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if !canPerform {
+		// Lets a dry run tell a refusal apart from anything else that stopped it
+		if denied, ok := ctx.Value(deniedKey).(*bool); ok {
+			*denied = true
+		}
+
+		return common.SendError(denial(ctx, p.PermissionsList))
+	}
+
+	return ""
+}
+
+// denial tells somebody who was turned away which groups would have let them
+// in and who can put them in one.
+func denial(ctx context.Context, groups []string) string {
+	message := fmt.Sprintf("User doesn't have permission to this command, it needs one of: %s", strings.Join(grantingGroups(groups), ", "))
+
+	administrators := settings.Membership
+	if contains(groups, "perms_admins") {
+		administrators = []string{"server_admins"}
+	}
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return message
+	}
+
+	var admins []string
+	seen := make(map[string]bool)
+	for _, group := range administrators {
+		users, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: group})
+		if err != nil {
+			return message
+		}
+
+		for _, user := range users.UserList {
+			if !seen[user] {
+				seen[user] = true
+				admins = append(admins, userName(names, user))
+			}
+		}
+	}
+
+	sort.Strings(admins)
+	if len(admins) > maxAdminsNamed {
+		admins = append(admins[:maxAdminsNamed], fmt.Sprintf("%d more", len(admins)-maxAdminsNamed))
+	}
+
+	if len(admins) == 0 {
+		return fmt.Sprintf("%s. They're administered by %s", message, strings.Join(administrators, ", "))
+	}
+
+	return fmt.Sprintf("%s. They're administered by %s: %s", message, strings.Join(administrators, ", "), strings.Join(admins, ", "))
+}
+
+// checkChannel returns the response to send when the sender's channel isn't
+// one of the admin channels, or an empty string when they may carry on.
+//
+// DMs should arguably get through for protected listings, but the sender only
+// carries a channel id and nothing tells us whether it's a DM. Until there's
+// a way to find out, DMs are refused like any other channel.
+func checkChannel(sender string) string {
+	if len(settings.AdminChannels) == 0 {
+		return ""
+	}
+
+	channel := strings.Split(sender, ":")[0]
+	var channels []string
+	for _, c := range settings.AdminChannels {
+		c = extractChannelId(c)
+		if c == channel {
+			return ""
+		}
+		channels = append(channels, c)
+	}
+
+	return common.SendError(fmt.Sprintf("This command can only be used in %s", channelMentions(channels)))
+}
+
+func channelMentions(channels []string) string {
+	var mentions []string
+	for _, c := range channels {
+		mentions = append(mentions, fmt.Sprintf("<#%s>", c))
+	}
+
+	return strings.Join(mentions, ", ")
+}
+
+// isProtected reports whether permission's membership is only visible to auditors and admins.
+func isProtected(permission string) bool {
+	for _, p := range settings.ProtectedGroups {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// capability returns the permissions needed to run subcommand.
+func capability(subcommand string) *permissions {
+	switch subcommand {
+	case "create":
+		return createPerms
+	case "destroy":
+		return destroyPerms
+	}
+
+	return membershipPerms
+}
+
+// senderId returns the user part of a channel:user sender.
+func senderId(sender string) string {
+	return strings.Split(sender, ":")[1]
+}
@@ -0,0 +1,171 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"strconv"
+	"strings"
+)
+
+func listAudit(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) > 3 {
+		return common.SendError("Usage: !perms audit [count]")
+	}
+
+	count := 20
+	if len(req.Args) == 3 {
+		var err error
+		if count, err = strconv.Atoi(req.Args[2]); err != nil || count < 1 {
+			return common.SendError("Usage: !perms audit [count]")
+		}
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+		return msg
+	}
+
+	var entries []auditEntry
+	store.view(func(st *state) {
+		start := len(st.Audit) - count
+		if start < 0 {
+			start = 0
+		}
+		entries = append(entries, st.Audit[start:]...)
+	})
+
+	if len(entries) == 0 {
+		return common.SendError("No changes recorded")
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Audit Trail:\n")
+	for _, entry := range entries {
+		buffer.WriteString(fmt.Sprintf("\t%d: %s by %s: %s", entry.Id, entry.Time.UTC().Format("2006-01-02 15:04"), entry.Sender, entry.Command))
+		if entry.ApprovedBy != "" {
+			buffer.WriteString(fmt.Sprintf(" (approved by %s)", entry.ApprovedBy))
+		}
+		if entry.RevertedBy != 0 {
+			buffer.WriteString(fmt.Sprintf(" (reverted by %d)", entry.RevertedBy))
+		}
+		buffer.WriteString("\n")
+
+		for _, change := range entry.Changes {
+			buffer.WriteString(fmt.Sprintf("\t\t%s\n", change))
+		}
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func undoChange(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 2 && (len(req.Args) != 3 || req.Args[2] != "--cascade") {
+		return common.SendError("Usage: !perms undo [--cascade]")
+	}
+
+	var entry auditEntry
+	var ok bool
+	store.view(func(st *state) {
+		for i := len(st.Audit) - 1; i >= 0; i-- {
+			if st.Audit[i].Sender == senderId(req.Sender) && st.Audit[i].Reverts == 0 && st.Audit[i].RevertedBy == 0 {
+				entry, ok = st.Audit[i], true
+				return
+			}
+		}
+	})
+
+	if !ok {
+		return common.SendError("You have no changes to undo")
+	}
+
+	// Pin the change down so a confirmation can't end up undoing something newer
+	pinned := append([]string{req.Args[0], "revert", strconv.Itoa(entry.Id)}, req.Args[2:]...)
+	return revertEntry(ctx, &proto.ExecRequest{Sender: req.Sender, Args: pinned}, entry)
+}
+
+func revertChange(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 && (len(req.Args) != 4 || req.Args[3] != "--cascade") {
+		return common.SendError("Usage: !perms revert <audit_id> [--cascade]")
+	}
+
+	id, err := strconv.Atoi(req.Args[2])
+	if err != nil {
+		return common.SendError("Usage: !perms revert <audit_id> [--cascade]")
+	}
+
+	var entry auditEntry
+	var ok bool
+	store.view(func(st *state) {
+		for _, e := range st.Audit {
+			if e.Id == id {
+				entry, ok = e, true
+			}
+		}
+	})
+
+	if !ok {
+		return common.SendError(fmt.Sprintf("No change with id %d", id))
+	}
+
+	return revertEntry(ctx, req, entry)
+}
+
+func revertEntry(ctx context.Context, req *proto.ExecRequest, entry auditEntry) string {
+	if entry.RevertedBy != 0 {
+		return common.SendError(fmt.Sprintf("Change %d was already reverted by %d", entry.Id, entry.RevertedBy))
+	}
+
+	cascade := req.Args[len(req.Args)-1] == "--cascade"
+
+	// Undoing a create destroys the group as it is now, not as it was created,
+	// so it's held to the same rules as destroy
+	var destroys []string
+	changes := entry.inverse()
+	for i, change := range changes {
+		if change.Action != "destroy" {
+			continue
+		}
+
+		users, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: change.Group})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		if len(users.UserList) > 0 && !cascade {
+			return common.SendError(fmt.Sprintf("'%s' now has %d members, add --cascade to remove them as well",
+				change.Group, len(users.UserList)))
+		}
+
+		if changes[i], err = destroyOperation(ctx, change.Group, users.UserList); err != nil {
+			return common.SendFatal(err.Error())
+		}
+		destroys = append(destroys, changes[i].String())
+	}
+
+	if msg := authorizeChanges(ctx, req, changes); msg != "" {
+		return msg
+	}
+
+	if len(destroys) > 0 && !isConfirmed(ctx) {
+		return requestConfirmation(ctx, req, fmt.Sprintf("Reverting %d will %s", entry.Id, strings.Join(destroys, ", ")))
+	}
+
+	id, err := applyChanges(ctx, req, changes, entry.Id)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var summary []string
+	for _, change := range changes {
+		summary = append(summary, change.String())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Reverted %d as %d: %s\n", entry.Id, id, strings.Join(summary, ", ")))
+}
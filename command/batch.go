@@ -0,0 +1,242 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+const batchUsage = "Usage: !perms batch ```<subcommand> <arguments>\n...```\nSubcommands are create, add, remove and destroy, one per line or separated by ;"
+
+// batchPlan tracks what the permission groups will look like part way
+// through a batch so every step can be checked before anything is changed.
+type batchPlan struct {
+	ctx     context.Context
+	exists  map[string]bool
+	members map[string]map[string]bool
+	changes []operation
+}
+
+func runBatch(ctx context.Context, req *proto.ExecRequest) string {
+	lines := batchLines(strings.Join(req.Args[2:], " "))
+	if len(lines) == 0 {
+		return common.SendError(batchUsage)
+	}
+
+	plan, err := newBatchPlan(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var buffer bytes.Buffer
+	var problems int
+	var destructive bool
+	for i, line := range lines {
+		if err := plan.add(line); err != nil {
+			buffer.WriteString(fmt.Sprintf("\t%d: %s: %s\n", i+1, strings.Join(line, " "), err))
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Sprintf("```Batch not run, %d of %d steps are invalid:\n%s```", problems, len(lines), buffer.String())
+	}
+
+	if msg := authorizeChanges(ctx, req, plan.changes); msg != "" {
+		return msg
+	}
+
+	for _, change := range plan.changes {
+		buffer.WriteString(fmt.Sprintf("\t%s\n", change))
+		destructive = destructive || change.Action == "destroy" || change.Action == "remove"
+	}
+
+	if destructive && !isConfirmed(ctx) {
+		return requestConfirmation(ctx, req, fmt.Sprintf("This batch will make %d changes:\n%s", len(plan.changes), buffer.String()))
+	}
+
+	id, err := applyChanges(ctx, req, plan.changes, 0)
+	switch {
+	case err == nil:
+	case rolledBack(err):
+		return common.SendFatal(fmt.Sprintf("Batch rolled back, %s", err))
+	case isDryRun(ctx):
+		return common.SendFatal(err.Error())
+	default:
+		return common.SendFatal(fmt.Sprintf("Batch failed and wasn't fully rolled back, %s", err))
+	}
+
+	return fmt.Sprintf("```Batch %d made %d changes:\n%s```", id, len(plan.changes), buffer.String())
+}
+
+// batchLines splits a batch, which may be wrapped in a code block, into its commands.
+func batchLines(text string) [][]string {
+	var lines [][]string
+
+	text = strings.Replace(text, "```", "\n", -1)
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ';' }) {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && (fields[0] == "!perms" || fields[0] == cmdName) {
+			fields = fields[1:]
+		}
+
+		if len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	return lines
+}
+
+func newBatchPlan(ctx context.Context) (*batchPlan, error) {
+	plan := &batchPlan{ctx: ctx, exists: make(map[string]bool), members: make(map[string]map[string]bool)}
+
+	permissions, err := clientFactory.NewPermsClient().ListPermissions(ctx, &permsrv.NilRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, perm := range permissions.PermissionsList {
+		plan.exists[perm.Name] = true
+	}
+
+	return plan, nil
+}
+
+// membersOf returns who will be in group at this point in the batch.
+func (p *batchPlan) membersOf(group string) (map[string]bool, error) {
+	if members, ok := p.members[group]; ok {
+		return members, nil
+	}
+
+	members := make(map[string]bool)
+	users, err := clientFactory.NewPermsClient().ListPermissionUsers(p.ctx, &permsrv.UsersRequest{Permission: group})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users.UserList {
+		members[user] = true
+	}
+
+	p.members[group] = members
+	return members, nil
+}
+
+// add checks one line of the batch against the plan so far and adds its change.
+func (p *batchPlan) add(line []string) error {
+	switch line[0] {
+	case "create":
+		if len(line) < 3 {
+			return fmt.Errorf("usage: create <permission_group> <group_description>")
+		}
+
+		if p.exists[line[1]] {
+			return fmt.Errorf("'%s' already exists", line[1])
+		}
+
+		description := strings.Trim(strings.Join(line[2:], " "), `"`)
+		if common.IsDiscordUser(line[1]) || common.IsDiscordUser(description) {
+			return fmt.Errorf("discord users may not be permissions or descriptions")
+		}
+
+		p.exists[line[1]] = true
+		p.members[line[1]] = make(map[string]bool)
+		p.changes = append(p.changes, operation{Action: "create", Group: line[1], Description: description})
+
+	case "add", "remove":
+		if len(line) < 3 || !common.IsDiscordUser(line[1]) {
+			return fmt.Errorf("usage: %s <user> <permission_group>", line[0])
+		}
+
+		user, group := common.ExtractUserId(line[1]), line[2]
+		if !p.exists[group] {
+			return fmt.Errorf("'%s' doesn't exist", group)
+		}
+
+		members, err := p.membersOf(group)
+		if err != nil {
+			return err
+		}
+
+		if line[0] == "add" {
+			var channels []string
+			if len(line) > 3 {
+				if line[3] != "--in" || len(line) == 4 {
+					return fmt.Errorf("usage: add <user> <permission_group> [--in <channel>...]")
+				}
+
+				for _, channel := range line[4:] {
+					channels = append(channels, extractChannelId(channel))
+				}
+			}
+
+			if members[user] {
+				return fmt.Errorf("already a member of '%s'", group)
+			}
+
+			if lifecycleOf(group) == lifecycleArchived {
+				return fmt.Errorf("'%s' is archived", group)
+			}
+
+			members[user] = true
+			p.changes = append(p.changes, operation{Action: "add", Group: group, User: user, Channels: channels})
+		} else {
+			if !members[user] {
+				return fmt.Errorf("not a member of '%s'", group)
+			}
+
+			delete(members, user)
+			p.changes = append(p.changes, operation{Action: "remove", Group: group, User: user, Channels: scopeOf(group, user)})
+		}
+
+	case "destroy":
+		if len(line) != 2 && (len(line) != 3 || line[2] != "--cascade") {
+			return fmt.Errorf("usage: destroy <permission_group> [--cascade]")
+		}
+
+		group := line[1]
+		if !p.exists[group] {
+			return fmt.Errorf("'%s' doesn't exist", group)
+		}
+
+		members, err := p.membersOf(group)
+		if err != nil {
+			return err
+		}
+
+		if len(members) > 0 && len(line) != 3 {
+			return fmt.Errorf("'%s' will still have %d members, add --cascade to remove them as well", group, len(members))
+		}
+
+		var users []string
+		for user := range members {
+			users = append(users, user)
+		}
+
+		change, err := destroyOperation(p.ctx, group, users)
+		if err != nil {
+			return err
+		}
+
+		// A group made earlier in the batch isn't in perms-srv yet
+		for _, earlier := range p.changes {
+			if earlier.Action == "create" && earlier.Group == group {
+				change.Description = earlier.Description
+			}
+		}
+
+		delete(p.exists, group)
+		delete(p.members, group)
+		p.changes = append(p.changes, change)
+
+	default:
+		return fmt.Errorf("batches may only create, add, remove and destroy")
+	}
+
+	return nil
+}
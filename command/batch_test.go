@@ -0,0 +1,171 @@
+package command
+
+import (
+	"golang.org/x/net/context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want [][]string
+	}{
+		{
+			name: "semicolons",
+			text: "add <@1> fcs; remove <@2> fcs",
+			want: [][]string{{"add", "<@1>", "fcs"}, {"remove", "<@2>", "fcs"}},
+		},
+		{
+			name: "code block",
+			text: "```\ncreate fcs \"Fleet commanders\"\nadd <@1> fcs\n```",
+			want: [][]string{{"create", "fcs", "\"Fleet", "commanders\""}, {"add", "<@1>", "fcs"}},
+		},
+		{
+			name: "command prefixes",
+			text: "!perms add <@1> fcs\nperms add <@2> fcs; add <@3> fcs",
+			want: [][]string{{"add", "<@1>", "fcs"}, {"add", "<@2>", "fcs"}, {"add", "<@3>", "fcs"}},
+		},
+		{
+			name: "blank lines",
+			text: "``` ; \n\n!perms ;```",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := batchLines(test.text); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("batchLines(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBatchPlanAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		wantErr string
+		want    []string
+	}{
+		{
+			name:  "create",
+			lines: []string{`create scouts "Scouts"`},
+			want:  []string{"create scouts"},
+		},
+		{
+			name:    "create existing",
+			lines:   []string{"create fcs Fleet commanders"},
+			wantErr: "already exists",
+		},
+		{
+			name:    "create a user",
+			lines:   []string{"create <@5> Somebody"},
+			wantErr: "discord users may not be permissions",
+		},
+		{
+			name:  "add and remove",
+			lines: []string{"add <@2> fcs", "remove <@1> fcs"},
+			want:  []string{"add 2 to fcs", "remove 1 from fcs"},
+		},
+		{
+			name:  "add to a group made earlier",
+			lines: []string{"create scouts Scouts", "add <@2> scouts --in <#9>", "remove <@2> scouts"},
+			want:  []string{"create scouts", "add 2 to scouts in 9", "remove 2 from scouts"},
+		},
+		{
+			name:    "add twice",
+			lines:   []string{"add <@2> fcs", "add <@2> fcs"},
+			wantErr: "already a member",
+		},
+		{
+			name:    "add a member",
+			lines:   []string{"add <@1> fcs"},
+			wantErr: "already a member",
+		},
+		{
+			name:    "add without a channel",
+			lines:   []string{"add <@2> fcs --in"},
+			wantErr: "usage: add",
+		},
+		{
+			name:    "add to a missing group",
+			lines:   []string{"add <@2> scouts"},
+			wantErr: "doesn't exist",
+		},
+		{
+			name:    "add to an archived group",
+			lines:   []string{"add <@2> retired"},
+			wantErr: "is archived",
+		},
+		{
+			name:    "remove a non member",
+			lines:   []string{"remove <@2> fcs"},
+			wantErr: "not a member",
+		},
+		{
+			name:    "remove twice",
+			lines:   []string{"remove <@1> fcs", "remove <@1> fcs"},
+			wantErr: "not a member",
+		},
+		{
+			name:    "remove somebody who isn't a user",
+			lines:   []string{"remove fcs"},
+			wantErr: "usage: remove",
+		},
+		{
+			name:    "unknown",
+			lines:   []string{"offboard <@1>"},
+			wantErr: "may only create, add, remove and destroy",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestState(t)
+			if err := updateGroup("retired", func(info *groupInfo) { info.Lifecycle = lifecycleArchived }); err != nil {
+				t.Fatal(err)
+			}
+
+			// Filling in the members up front keeps the plan from asking perms-srv
+			plan := &batchPlan{
+				ctx:    context.Background(),
+				exists: map[string]bool{"fcs": true, "retired": true},
+				members: map[string]map[string]bool{
+					"fcs":     {"1": true},
+					"retired": {},
+				},
+			}
+
+			var err error
+			for _, line := range test.lines {
+				if err = plan.add(strings.Fields(line)); err != nil {
+					break
+				}
+			}
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, change := range plan.changes {
+				got = append(got, change.String())
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("changes = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
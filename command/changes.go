@@ -0,0 +1,315 @@
+package command
+
+import (
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+// operation is a single change to perms-srv, with enough detail to undo it.
+type operation struct {
+	Action      string              `json:"action"`
+	Group       string              `json:"group"`
+	User        string              `json:"user,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Members     []string            `json:"members,omitempty"`
+	Channels    []string            `json:"channels,omitempty"`
+	Scopes      map[string][]string `json:"scopes,omitempty"`
+	Window      *window             `json:"window,omitempty"`
+	Rotation    *rotation           `json:"rotation,omitempty"`
+	Link        *link               `json:"link,omitempty"`
+	Info        *groupInfo          `json:"info,omitempty"`
+	IncludedBy  []string            `json:"includedBy,omitempty"`
+}
+
+// auditEntry records the changes made by one command.
+type auditEntry struct {
+	Id         int         `json:"id"`
+	Time       time.Time   `json:"time"`
+	Sender     string      `json:"sender"`
+	Command    string      `json:"command"`
+	Changes    []operation `json:"changes"`
+	Reverts    int         `json:"reverts,omitempty"`
+	RevertedBy int         `json:"revertedBy,omitempty"`
+
+	// ApprovedBy is the second admin who approved the changes under the two person rule
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+func (o operation) apply(ctx context.Context) error {
+	var err error
+	permsClient := clientFactory.NewPermsClient()
+
+	switch o.Action {
+	case "create":
+		_, err = permsClient.AddPermission(ctx, &permsrv.Permission{Name: o.Group, Description: o.Description})
+		if err != nil {
+			return err
+		}
+
+		for _, user := range o.Members {
+			_, err = permsClient.AddPermissionUser(ctx, &permsrv.PermissionUser{User: user, Permission: o.Group})
+			if err != nil {
+				return err
+			}
+		}
+
+		return store.update(func(st *state) {
+			if len(o.Scopes) > 0 {
+				st.Scopes[o.Group] = o.Scopes
+			}
+			if o.Window != nil {
+				st.Windows[o.Group] = *o.Window
+			}
+			if o.Rotation != nil {
+				st.Rotations[o.Group] = *o.Rotation
+			}
+			if o.Link != nil {
+				st.Links[o.Group] = *o.Link
+			}
+			if o.Info != nil {
+				info := *o.Info
+				// Restoring an expired group shouldn't have it expire again straight away
+				if !info.Expires.IsZero() && !time.Now().Before(info.Expires) {
+					// The expiry warning archived it as well
+					if info.Notified && info.Lifecycle == lifecycleArchived {
+						info.Lifecycle = ""
+					}
+					info.Expires = time.Time{}
+					info.Notified = false
+				}
+				if !info.empty() {
+					st.Groups[o.Group] = info
+				}
+			}
+			for _, parent := range o.IncludedBy {
+				info, ok := st.Groups[parent]
+				if ok && !contains(info.Includes, o.Group) {
+					info.Includes = append(info.Includes, o.Group)
+					st.Groups[parent] = info
+				}
+			}
+			delete(st.Destroyed, o.Group)
+		})
+
+	case "destroy":
+		for _, user := range o.Members {
+			_, err = permsClient.RemovePermissionUser(ctx, &permsrv.PermissionUser{User: user, Permission: o.Group})
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = permsClient.RemovePermission(ctx, &permsrv.Permission{Name: o.Group})
+		if err != nil {
+			return err
+		}
+
+		return store.update(func(st *state) {
+			delete(st.Scopes, o.Group)
+			delete(st.Groups, o.Group)
+			delete(st.Links, o.Group)
+			delete(st.Windows, o.Group)
+			delete(st.Rotations, o.Group)
+			for group, info := range st.Groups {
+				info.Includes = without(info.Includes, o.Group)
+				st.Groups[group] = info
+			}
+			st.Destroyed[o.Group] = o
+		})
+
+	case "add":
+		_, err = permsClient.AddPermissionUser(ctx, &permsrv.PermissionUser{User: o.User, Permission: o.Group})
+		if err != nil {
+			return err
+		}
+
+		return setScope(o.Group, o.User, o.Channels)
+
+	case "remove":
+		// Members held back by a closed window aren't in perms-srv until it opens
+		stashed, err := unstash(o.Group, o.User)
+		if err != nil {
+			return err
+		}
+
+		_, err = permsClient.RemovePermissionUser(ctx, &permsrv.PermissionUser{User: o.User, Permission: o.Group})
+		if err != nil && !stashed {
+			return err
+		}
+
+		return setScope(o.Group, o.User, nil)
+	}
+
+	return fmt.Errorf("unknown action: %s", o.Action)
+}
+
+// inverse returns the operation that puts things back the way they were before o.
+func (o operation) inverse() operation {
+	inverse := o
+
+	switch o.Action {
+	case "create":
+		inverse.Action = "destroy"
+	case "destroy":
+		inverse.Action = "create"
+	case "add":
+		inverse.Action = "remove"
+	case "remove":
+		inverse.Action = "add"
+	}
+
+	return inverse
+}
+
+func (o operation) String() string {
+	switch o.Action {
+	case "create":
+		if len(o.Members) > 0 {
+			return fmt.Sprintf("create %s with %d members", o.Group, len(o.Members))
+		}
+		return fmt.Sprintf("create %s", o.Group)
+	case "destroy":
+		return fmt.Sprintf("destroy %s with %d members", o.Group, len(o.Members))
+	case "add":
+		if len(o.Channels) > 0 {
+			return fmt.Sprintf("add %s to %s in %s", o.User, o.Group, strings.Join(o.Channels, ", "))
+		}
+		return fmt.Sprintf("add %s to %s", o.User, o.Group)
+	case "remove":
+		return fmt.Sprintf("remove %s from %s", o.User, o.Group)
+	}
+
+	return o.Action
+}
+
+// changeError is returned by applyChanges when a change fails, saying which
+// of the changes before it couldn't be rolled back.
+type changeError struct {
+	change operation
+	err    error
+	stuck  []string
+}
+
+func (e *changeError) Error() string {
+	if len(e.stuck) == 0 {
+		return fmt.Sprintf("%s failed: %v", e.change, e.err)
+	}
+
+	return fmt.Sprintf("%s failed: %v, and rolling back failed as well so these are still in place: %s",
+		e.change, e.err, strings.Join(e.stuck, "; "))
+}
+
+// rolledBack reports whether err left everything as it was before applyChanges.
+func rolledBack(err error) bool {
+	e, ok := err.(*changeError)
+	return ok && len(e.stuck) == 0
+}
+
+// applyChanges makes every change in order and records them in the audit
+// trail. If one fails, the ones already made are rolled back.
+func applyChanges(ctx context.Context, req *proto.ExecRequest, changes []operation, reverts int) (int, error) {
+	if isDryRun(ctx) {
+		var summary []string
+		for _, change := range changes {
+			summary = append(summary, change.String())
+		}
+		return 0, fmt.Errorf("dry run, would have made: %s", strings.Join(summary, ", "))
+	}
+
+	for i, change := range changes {
+		if err := change.apply(ctx); err != nil {
+			failure := &changeError{change: change, err: err}
+			for j := i - 1; j >= 0; j-- {
+				if err := changes[j].inverse().apply(ctx); err != nil {
+					logger.Error("Unable to roll back change", zap.String("change", changes[j].String()), zap.Error(err))
+					failure.stuck = append(failure.stuck, fmt.Sprintf("%s (%v)", changes[j], err))
+				}
+			}
+			return 0, failure
+		}
+	}
+
+	var id int
+	err := store.update(func(st *state) {
+		id = 1
+		if len(st.Audit) > 0 {
+			id = st.Audit[len(st.Audit)-1].Id + 1
+		}
+
+		st.Audit = append(st.Audit, auditEntry{
+			Id:         id,
+			Time:       time.Now(),
+			Sender:     senderId(req.Sender),
+			Command:    strings.Join(req.Args[1:], " "),
+			Changes:    changes,
+			Reverts:    reverts,
+			ApprovedBy: approvedBy(ctx),
+		})
+
+		if reverts != 0 {
+			for i := range st.Audit {
+				if st.Audit[i].Id == reverts {
+					st.Audit[i].RevertedBy = id
+				}
+			}
+		}
+	})
+
+	return id, err
+}
+
+// inverse returns the changes that undo everything in e, last change first.
+func (e auditEntry) inverse() []operation {
+	var changes []operation
+	for i := len(e.Changes) - 1; i >= 0; i-- {
+		changes = append(changes, e.Changes[i].inverse())
+	}
+
+	return changes
+}
+
+// authorizeChanges checks that the sender may make every one of changes,
+// returning the response to send if they may not.
+func authorizeChanges(ctx context.Context, req *proto.ExecRequest, changes []operation) string {
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	var needsApproval bool
+	for _, change := range changes {
+		if change.Group == "perms_admins" {
+			if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+				return msg
+			}
+		}
+
+		if msg := checkPermission(ctx, req.Sender, capability(change.Action)); msg != "" {
+			return msg
+		}
+
+		if change.Action == "create" && len(change.Members) > 0 {
+			if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+				return msg
+			}
+		}
+
+		if change.Action == "add" || change.Action == "remove" {
+			if msg := checkSelfModification(ctx, req, change.User, change.Group); msg != "" {
+				return msg
+			}
+		}
+
+		needsApproval = needsApproval || change.Action == "destroy" || isProtected(change.Group)
+	}
+
+	if settings.TwoPersonRule && !isConfirmed(ctx) && needsApproval {
+		return requestApproval(ctx, req, "These changes need approval")
+	}
+
+	return ""
+}
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+// checkUser explains whether a user passes the permission check for a set of
+// groups, first as perms-srv sees it and then with everything perms-cmd adds.
+func checkUser(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 4 || !common.IsDiscordUser(req.Args[2]) {
+		return common.SendError("Usage: !perms check <user> <permission_group>...")
+	}
+
+	user, groups := common.ExtractUserId(req.Args[2]), req.Args[3:]
+	channel := strings.Split(req.Sender, ":")[0]
+
+	// Anybody may ask about themselves
+	if user != senderId(req.Sender) {
+		if msg := checkChannel(req.Sender); msg != "" {
+			return msg
+		}
+
+		if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+			return msg
+		}
+	}
+
+	permsClient := clientFactory.NewPermsClient()
+
+	// The same request pclient.Permissions.CanPerform makes
+	perform, err := permsClient.Perform(ctx, &permsrv.PermissionsRequest{User: user, PermissionsList: groups})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	canPerform, err := newPermission(permsClient, groups).CanPerform(ctx, channel+":"+user)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	permissions, err := permsClient.ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var direct []string
+	for _, perm := range permissions.PermissionsList {
+		direct = append(direct, perm.Name)
+	}
+
+	held := expandGroups(direct, func(string) bool { return true })
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("perms-srv Perform: %s\n", allowedOrDenied(perform.CanPerform)))
+	buffer.WriteString(fmt.Sprintf("perms-cmd from <#%s>: %s\n", channel, allowedOrDenied(canPerform)))
+
+	for _, group := range groups {
+		buffer.WriteString(fmt.Sprintf("%s:\n", group))
+
+		via, ok := held[group]
+		switch {
+		case !ok:
+			buffer.WriteString("\tnot held\n")
+			if granting := grantingGroups([]string{group}); len(granting) > 1 {
+				buffer.WriteString(fmt.Sprintf("\tgranted by %s\n", strings.Join(granting, ", ")))
+			}
+		case via == "":
+			buffer.WriteString("\theld directly\n")
+			if channels := scopeOf(group, user); len(channels) > 0 {
+				buffer.WriteString(fmt.Sprintf("\tonly in %s, %s here\n", channelMentions(channels), allowedOrDenied(inScope(group, user, channel))))
+			}
+		default:
+			buffer.WriteString(fmt.Sprintf("\tinherited%s\n", inheritanceChain(held, group)))
+		}
+
+		// Everything the grant depends on, the group itself and whatever it came through
+		for g := group; ok && g != ""; g = held[g] {
+			explainGroup(&buffer, g, user)
+		}
+
+		if !ok {
+			explainGroup(&buffer, group, user)
+		}
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// explainGroup adds whatever stops group granting anything to user right now.
+func explainGroup(buffer *bytes.Buffer, group, user string) {
+	var w window
+	var hasWindow bool
+	store.view(func(st *state) {
+		w, hasWindow = st.Windows[group]
+	})
+
+	if hasWindow {
+		status := "closed"
+		if w.open(time.Now()) {
+			status = "open"
+		}
+		buffer.WriteString(fmt.Sprintf("\t%s is only active %s UTC and is %s now\n", group, w.Spec, status))
+
+		if _, stashed := w.Stashed[user]; stashed {
+			buffer.WriteString(fmt.Sprintf("\tmembership of %s is held back until the window opens\n", group))
+		}
+	}
+
+	if info := groupInfoOf(group); !info.Expires.IsZero() {
+		if time.Now().Before(info.Expires) {
+			buffer.WriteString(fmt.Sprintf("\t%s expires at %s UTC\n", group, info.Expires.UTC().Format("2006-01-02 15:04")))
+		} else {
+			buffer.WriteString(fmt.Sprintf("\t%s expired at %s UTC and is about to be destroyed\n", group, info.Expires.UTC().Format("2006-01-02 15:04")))
+		}
+	}
+
+	if lifecycle := lifecycleOf(group); lifecycle != lifecycleActive {
+		buffer.WriteString(fmt.Sprintf("\t%s is%s\n", group, lifecycleNote(group)))
+	}
+}
+
+func allowedOrDenied(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+
+	return "denied"
+}
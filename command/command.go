@@ -3,27 +3,39 @@ package command
 import (
 	"bytes"
 	"fmt"
+	"github.com/chremoas/chremoas/args"
 	proto "github.com/chremoas/chremoas/proto"
 	permsrv "github.com/chremoas/perms-srv/proto"
-	pclient "github.com/chremoas/perms-srv/client"
-	rolesrv "github.com/chremoas/role-srv/proto"
 	rclient "github.com/chremoas/role-srv/client"
-	"github.com/chremoas/chremoas/args"
+	rolesrv "github.com/chremoas/role-srv/proto"
 	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"strings"
+	"time"
 )
 
 type ClientFactory interface {
 	NewPermsClient() permsrv.PermissionsService
 	NewRolesClient() rolesrv.RolesService
+
+	// CommandMetadata returns the registry metadata of the named command service's nodes
+	CommandMetadata(command string) (map[string]string, error)
+
+	// ListCommands returns the names of the command services in the registry
+	ListCommands() ([]string, error)
 }
 
 var cmdName = "perms"
-var perms *pclient.Permissions
-var serverPerms *pclient.Permissions
+var createPerms *permissions
+var destroyPerms *permissions
+var membershipPerms *permissions
+var serverPerms *permissions
+var auditorPerms *permissions
+var settings Settings
 var clientFactory ClientFactory
 var role rclient.Roles
+var logger *zap.Logger
 
 type Command struct {
 	//Store anything you need the Help or Exec functions to have access to here
@@ -38,24 +50,82 @@ func (c *Command) Help(ctx context.Context, req *proto.HelpRequest, rsp *proto.H
 }
 
 func (c *Command) Exec(ctx context.Context, req *proto.ExecRequest, rsp *proto.ExecResponse) error {
-	cmd := args.NewArg(cmdName)
-	cmd.Add("list", &args.Command{listPermissions, "List all Permissions"})
-	cmd.Add("create", &args.Command{addPermission, "Add Permission"})
-	cmd.Add("destroy", &args.Command{removePermission, "Delete Permission"})
-	cmd.Add("add", &args.Command{addPermissionUser, "Add user to permission group"})
-	cmd.Add("remove", &args.Command{removePermissionUser, "Remove user from permission group"})
-	cmd.Add("list_users", &args.Command{listPermissionsUsers, "List users in a permission group"})
-	cmd.Add("list_user_perms", &args.Command{listUserPermissions, "List all the permissions a user has"})
-	err := cmd.Exec(ctx, req, rsp)
+	err := commands().Exec(ctx, req, rsp)
 
 	// I don't 100% love this, but it'll do for now. -brian
 	if err != nil {
 		rsp.Result = []byte(common.SendError(err.Error()))
 	}
+
+	// perms-cmd can only talk to people who talk to it, so this is where they hear about expiring groups
+	if strings.Contains(req.Sender, ":") {
+		if notices := takeNotices(senderId(req.Sender)); len(notices) > 0 {
+			rsp.Result = append([]byte(fmt.Sprintf("```%s```", strings.Join(notices, "\n"))), rsp.Result...)
+		}
+	}
 	return nil
 }
 
+func commands() *args.Args {
+	cmd := args.NewArg(cmdName)
+	cmd.Add("list", &args.Command{Funcptr: listPermissions, Help: "List all Permissions"})
+	cmd.Add("create", &args.Command{Funcptr: addPermission, Help: "Add Permission"})
+	cmd.Add("destroy", &args.Command{Funcptr: removePermission, Help: "Delete Permission"})
+	cmd.Add("restore", &args.Command{Funcptr: restorePermission, Help: "Recreate a destroyed Permission and its members"})
+	cmd.Add("add", &args.Command{Funcptr: addPermissionUser, Help: "Add user to permission group"})
+	cmd.Add("remove", &args.Command{Funcptr: removePermissionUser, Help: "Remove users from permission group"})
+	cmd.Add("offboard", &args.Command{Funcptr: offboardUser, Help: "Remove a user from every permission group"})
+	cmd.Add("list_users", &args.Command{Funcptr: listPermissionsUsers, Help: "List users in a permission group"})
+	cmd.Add("list_user_perms", &args.Command{Funcptr: listUserPermissions, Help: "List all the permissions a user has"})
+	cmd.Add("mine", &args.Command{Funcptr: listMine, Help: "List the permissions you have"})
+	cmd.Add("joinable", &args.Command{Funcptr: setJoinable, Help: "Let anybody join a permission group without an admin"})
+	cmd.Add("join", &args.Command{Funcptr: joinGroup, Help: "Join a joinable permission group"})
+	cmd.Add("leave", &args.Command{Funcptr: joinGroup, Help: "Leave a joinable permission group"})
+	cmd.Add("export", &args.Command{Funcptr: exportPermissions, Help: "Export every permission group and its members"})
+	cmd.Add("who_can", &args.Command{Funcptr: whoCan, Help: "List the groups, or users, that can run a command"})
+	cmd.Add("as", &args.Command{Funcptr: actAs, Help: "Try a command as another user without changing anything"})
+	cmd.Add("check", &args.Command{Funcptr: checkUser, Help: "Explain whether a user gets through a permission check"})
+	cmd.Add("impact", &args.Command{Funcptr: impact, Help: "Show the commands users would lose if a group or membership went"})
+	cmd.Add("diff", &args.Command{Funcptr: diffUsers, Help: "Compare two users' permission groups, or copy one's to the other"})
+	cmd.Add("whois", &args.Command{Funcptr: whois, Help: "Show a user's permission groups, roles, SIGs and Discord account"})
+	cmd.Add("confirm", &args.Command{Funcptr: confirmChange, Help: "Confirm a pending change"})
+	cmd.Add("pending", &args.Command{Funcptr: listPending, Help: "List changes waiting to be confirmed"})
+	cmd.Add("notices", &args.Command{Funcptr: listNotices, Help: "List the notices waiting for users to come back"})
+	cmd.Add("audit", &args.Command{Funcptr: listAudit, Help: "List recent permission changes"})
+	cmd.Add("undo", &args.Command{Funcptr: undoChange, Help: "Revert your most recent change"})
+	cmd.Add("revert", &args.Command{Funcptr: revertChange, Help: "Revert a change from the audit trail"})
+	cmd.Add("batch", &args.Command{Funcptr: runBatch, Help: "Run several changes together, all or nothing"})
+	cmd.Add("schedule", &args.Command{Funcptr: scheduleChange, Help: "Make an add, remove or destroy at a later time"})
+	cmd.Add("scheduled", &args.Command{Funcptr: scheduledChanges, Help: "List or cancel scheduled changes"})
+	cmd.Add("rotation", &args.Command{Funcptr: rotations, Help: "Rotate a group's membership through a roster"})
+	cmd.Add("window", &args.Command{Funcptr: setWindow, Help: "Limit when a permission group is active"})
+	cmd.Add("lifecycle", &args.Command{Funcptr: setLifecycle, Help: "Deprecate or archive a permission group"})
+	cmd.Add("migrate", &args.Command{Funcptr: migrateGroup, Help: "Move a deprecated group's members to its replacement"})
+	cmd.Add("include", &args.Command{Funcptr: includeGroup, Help: "Give a group's members another group as well"})
+	cmd.Add("exclude", &args.Command{Funcptr: includeGroup, Help: "Stop a group including another group"})
+	cmd.Add("tree", &args.Command{Funcptr: groupTree, Help: "Show which groups include which"})
+	cmd.Add("link", &args.Command{Funcptr: linkGroup, Help: "Keep a group in step with a role-srv filter or role"})
+	cmd.Add("unlink", &args.Command{Funcptr: unlinkGroup, Help: "Stop a group following role-srv"})
+	return cmd
+}
+
+// run executes req as though it had just come in from chat and returns the response.
+func run(ctx context.Context, req *proto.ExecRequest) string {
+	rsp := &proto.ExecResponse{}
+	if err := commands().Exec(ctx, req, rsp); err != nil {
+		return common.SendError(err.Error())
+	}
+
+	return string(rsp.Result)
+}
+
 func listPermissions(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) > 3 || (len(req.Args) == 3 && req.Args[2] != "all") {
+		return common.SendError("Usage: !perms list [all]")
+	}
+
+	all := len(req.Args) == 3
+
 	var buffer bytes.Buffer
 	permsClient := clientFactory.NewPermsClient()
 	permissions, err := permsClient.ListPermissions(ctx, &permsrv.NilRequest{})
@@ -66,7 +136,13 @@ func listPermissions(ctx context.Context, req *proto.ExecRequest) string {
 
 	buffer.WriteString("Permission Groups:\n")
 	for perm := range permissions.PermissionsList {
-		buffer.WriteString(fmt.Sprintf("\t%s: %s\n", permissions.PermissionsList[perm].Name, permissions.PermissionsList[perm].Description))
+		name := permissions.PermissionsList[perm].Name
+		if !all && lifecycleOf(name) == lifecycleArchived {
+			continue
+		}
+
+		buffer.WriteString(fmt.Sprintf("\t%s: %s%s%s\n", name, permissions.PermissionsList[perm].Description,
+			expiryNote(name), lifecycleNote(name)))
 	}
 
 	return fmt.Sprintf("```%s```", buffer.String())
@@ -77,6 +153,16 @@ func listPermissionsUsers(ctx context.Context, req *proto.ExecRequest) string {
 		return common.SendError("Usage: !perms list_users <permission_group>")
 	}
 
+	if isProtected(req.Args[2]) {
+		if msg := checkChannel(req.Sender); msg != "" {
+			return msg
+		}
+
+		if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+			return msg
+		}
+	}
+
 	permsClient := clientFactory.NewPermsClient()
 	users, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: req.Args[2]})
 
@@ -97,8 +183,22 @@ func listPermissionsUsers(ctx context.Context, req *proto.ExecRequest) string {
 }
 
 func addPermission(ctx context.Context, req *proto.ExecRequest) string {
+	const usage = "Usage: !perms create <permission_group> <group_description> [--expires <when>]"
 	if len(req.Args) < 4 {
-		return common.SendError("Usage: !perms create <permission_group> <group_description>")
+		return common.SendError(usage)
+	}
+
+	var expires time.Time
+	if n := len(req.Args); req.Args[n-2] == "--expires" {
+		if n < 6 {
+			return common.SendError(usage)
+		}
+
+		var err error
+		if expires, err = parseWhen(req.Args[n-1], time.Now()); err != nil {
+			return common.SendError(err.Error())
+		}
+		req.Args = req.Args[:n-2]
 	}
 
 	name := req.Args[2]
@@ -120,55 +220,77 @@ func addPermission(ctx context.Context, req *proto.ExecRequest) string {
 		description = description[:len(description)-1]
 	}
 
-	canPerform, err := perms.CanPerform(ctx, req.Sender)
-	if err != nil {
-		return common.SendFatal(err.Error())
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
 	}
 
-	if !canPerform {
-		return common.SendError("User doesn't have permission to this command")
+	if msg := checkPermission(ctx, req.Sender, createPerms); msg != "" {
+		return msg
 	}
 
-	permsClient := clientFactory.NewPermsClient()
-	_, err = permsClient.AddPermission(ctx, &permsrv.Permission{Name: name, Description: description})
+	_, err := applyChanges(ctx, req, []operation{{Action: "create", Group: name, Description: description}}, 0)
 	if err != nil {
 		return common.SendFatal(err.Error())
 	}
 
-	return common.SendSuccess(fmt.Sprintf("Created: %s\n", name))
+	if !expires.IsZero() {
+		err = updateGroup(name, func(info *groupInfo) {
+			info.Expires = expires
+		})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Created: %s%s\n", name, expiryNote(name)))
 }
 
 func addPermissionUser(ctx context.Context, req *proto.ExecRequest) string {
 	if len(req.Args) < 4 {
-		return common.SendError("Usage: !perms add <user> <permission_group>")
+		return common.SendError("Usage: !perms add <user> <permission_group> [--in <channel>...]")
 	}
 
 	user := common.ExtractUserId(req.Args[2])
 	permission := req.Args[3]
 
-	if permission == "perms_admins" {
-		canPerform, err := serverPerms.CanPerform(ctx, req.Sender)
-		if err != nil {
-			return common.SendFatal(err.Error())
+	var channels []string
+	if len(req.Args) > 4 {
+		if req.Args[4] != "--in" || len(req.Args) == 5 {
+			return common.SendError("Usage: !perms add <user> <permission_group> [--in <channel>...]")
 		}
 
-		if !canPerform {
-			return common.SendError("User doesn't have permission to this command")
+		for _, channel := range req.Args[5:] {
+			channels = append(channels, extractChannelId(channel))
 		}
 	}
 
-	canPerform, err := perms.CanPerform(ctx, req.Sender)
-	if err != nil {
-		return common.SendFatal(err.Error())
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
 	}
 
-	if !canPerform {
-		return common.SendError("User doesn't have permission to this command")
+	if lifecycleOf(permission) == lifecycleArchived {
+		return common.SendError(fmt.Sprintf("'%s' is archived and can't gain members", permission))
 	}
 
-	permsClient := clientFactory.NewPermsClient()
-	_, err = permsClient.AddPermissionUser(ctx,
-		&permsrv.PermissionUser{User: user, Permission: permission})
+	if permission == "perms_admins" {
+		if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+			return msg
+		}
+	}
+
+	if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+		return msg
+	}
+
+	if msg := checkSelfModification(ctx, req, user, permission); msg != "" {
+		return msg
+	}
+
+	if settings.TwoPersonRule && !isConfirmed(ctx) && isProtected(permission) {
+		return requestApproval(ctx, req, fmt.Sprintf("Changes to '%s' need approval", permission))
+	}
+
+	_, err := applyChanges(ctx, req, []operation{{Action: "add", Group: permission, User: user, Channels: channels}}, 0)
 	if err != nil {
 		return common.SendFatal(err.Error())
 	}
@@ -179,75 +301,166 @@ func addPermissionUser(ctx context.Context, req *proto.ExecRequest) string {
 		return common.SendError(err.Error())
 	}
 
-	return common.SendSuccess(fmt.Sprintf("Added '%s' to '%s'\n", u.Username, permission))
+	var warning string
+	if info := groupInfoOf(permission); info.Lifecycle == lifecycleDeprecated {
+		warning = fmt.Sprintf("Warning: '%s' is deprecated", permission)
+		if info.Replacement != "" {
+			warning += fmt.Sprintf(", consider `!perms add %s %s` instead", req.Args[2], info.Replacement)
+		}
+		warning += "\n"
+	}
+
+	if len(channels) > 0 {
+		return common.SendSuccess(fmt.Sprintf("Added '%s' to '%s' in %s\n"+
+			"The scope only holds for checks made through perms-cmd or its EffectivePermissions service, perms-srv sees a plain membership\n%s",
+			u.Username, permission, channelMentions(channels), warning))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Added '%s' to '%s'\n%s", u.Username, permission, warning))
 }
 
 func removePermission(ctx context.Context, req *proto.ExecRequest) string {
-	if len(req.Args) != 3 {
-		return common.SendError("Usage: !perms destroy <permission_group>")
+	if len(req.Args) != 3 && (len(req.Args) != 4 || req.Args[3] != "--cascade") {
+		return common.SendError("Usage: !perms destroy <permission_group> [--cascade]")
+	}
+
+	name := req.Args[2]
+	cascade := len(req.Args) == 4
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
 	}
 
-	canPerform, err := perms.CanPerform(ctx, req.Sender)
+	if msg := checkPermission(ctx, req.Sender, destroyPerms); msg != "" {
+		return msg
+	}
+
+	permsClient := clientFactory.NewPermsClient()
+	users, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: name})
 	if err != nil {
 		return common.SendFatal(err.Error())
 	}
 
-	if !canPerform {
-		return common.SendError("User doesn't have permission to this command")
+	if len(users.UserList) > 0 && !cascade {
+		return common.SendError(fmt.Sprintf("'%s' still has %d members, use `!perms destroy %s --cascade` to remove them as well",
+			name, len(users.UserList), name))
 	}
 
-	permsClient := clientFactory.NewPermsClient()
+	if settings.TwoPersonRule && !isConfirmed(ctx) {
+		return requestApproval(ctx, req, fmt.Sprintf("Destroying '%s' needs approval", name))
+	}
 
-	_, err = permsClient.RemovePermission(ctx, &permsrv.Permission{Name: req.Args[2]})
+	if !isConfirmed(ctx) {
+		if len(users.UserList) == 0 {
+			return requestConfirmation(ctx, req, fmt.Sprintf("'%s' has no members", name))
+		}
+
+		buffer, _, err := role.MapName(ctx, users.UserList)
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		return requestConfirmation(ctx, req, fmt.Sprintf("Destroying '%s' will remove its %d members:\n%s",
+			name, len(users.UserList), buffer.String()))
+	}
+
+	change, err := destroyOperation(ctx, name, users.UserList)
 	if err != nil {
 		return common.SendFatal(err.Error())
 	}
 
-	return common.SendSuccess(fmt.Sprintf("Destroyed: %s\n", req.Args[2]))
+	if _, err = applyChanges(ctx, req, []operation{change}, 0); err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if len(users.UserList) > 0 {
+		return common.SendSuccess(fmt.Sprintf("Destroyed: %s, removed %d members (`!perms restore %s` brings it back)\n",
+			name, len(users.UserList), name))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Destroyed: %s\n", name))
 }
 
 func removePermissionUser(ctx context.Context, req *proto.ExecRequest) string {
-	if len(req.Args) < 4 {
-		return common.SendError("Usage: !perms remove <user> <permission_group>")
+	const usage = "Usage: !perms remove <user>... <permission_group> [--dry-run]"
+	arguments := req.Args
+	if len(arguments) > 0 && arguments[len(arguments)-1] == "--dry-run" {
+		ctx = context.WithValue(ctx, dryRunKey, true)
+		arguments = arguments[:len(arguments)-1]
 	}
 
-	user := common.ExtractUserId(req.Args[2])
-	permission := req.Args[3]
+	if len(arguments) < 4 {
+		return common.SendError(usage)
+	}
+
+	permission := arguments[len(arguments)-1]
+
+	var users []string
+	for _, arg := range arguments[2 : len(arguments)-1] {
+		if !common.IsDiscordUser(arg) {
+			return common.SendError(usage)
+		}
+		users = append(users, common.ExtractUserId(arg))
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
 
 	if permission == "perms_admins" {
-		canPerform, err := serverPerms.CanPerform(ctx, req.Sender)
-		if err != nil {
-			return common.SendFatal(err.Error())
+		if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+			return msg
 		}
+	}
 
-		if !canPerform {
-			return common.SendError("User doesn't have permission to this command")
+	if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+		return msg
+	}
+
+	if isDryRun(ctx) {
+		removals := make(map[string][]string)
+		for _, user := range users {
+			removals[user] = []string{permission}
 		}
+
+		return impactReport(ctx, fmt.Sprintf("Removing them from '%s'", permission), removals, "")
 	}
 
-	canPerform, err := perms.CanPerform(ctx, req.Sender)
-	if err != nil {
-		return common.SendFatal(err.Error())
+	for _, user := range users {
+		if msg := checkSelfModification(ctx, req, user, permission); msg != "" {
+			return msg
+		}
 	}
 
-	if !canPerform {
-		return common.SendError("User doesn't have permission to this command")
+	if settings.TwoPersonRule && !isConfirmed(ctx) && isProtected(permission) {
+		return requestApproval(ctx, req, fmt.Sprintf("Changes to '%s' need approval", permission))
 	}
 
-	permsClient := clientFactory.NewPermsClient()
-	_, err = permsClient.RemovePermissionUser(ctx,
-		&permsrv.PermissionUser{User: user, Permission: permission})
+	names, err := userNames(ctx)
 	if err != nil {
 		return common.SendFatal(err.Error())
 	}
 
-	roleClient := clientFactory.NewRolesClient()
-	u, err := roleClient.GetDiscordUser(ctx, &rolesrv.GetDiscordUserRequest{UserId: user})
-	if err != nil {
-		return common.SendError(err.Error())
+	var removed []string
+	for _, user := range users {
+		removed = append(removed, fmt.Sprintf("'%s'", userName(names, user)))
+	}
+
+	if len(users) > 1 && !isConfirmed(ctx) {
+		return requestConfirmation(ctx, req, fmt.Sprintf("This will remove %d users from '%s':\n\t%s",
+			len(users), permission, strings.Join(removed, "\n\t")))
 	}
 
-	return common.SendSuccess(fmt.Sprintf("Removed '%s' from '%s'\n", u.Username, permission))
+	var changes []operation
+	for _, user := range users {
+		changes = append(changes, operation{Action: "remove", Group: permission, User: user, Channels: memberChannels(permission, user)})
+	}
+
+	if _, err = applyChanges(ctx, req, changes, 0); err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Removed %s from '%s'\n", strings.Join(removed, ", "), permission))
 }
 
 func listUserPermissions(ctx context.Context, req *proto.ExecRequest) string {
@@ -264,20 +477,67 @@ func listUserPermissions(ctx context.Context, req *proto.ExecRequest) string {
 		return common.SendFatal(err.Error())
 	}
 
+	user := req.Args[2]
+	if common.IsDiscordUser(user) {
+		user = common.ExtractUserId(user)
+	}
+
+	var direct []string
 	buffer.WriteString("Permission Groups:\n")
 	for perm := range permissions.PermissionsList {
-		buffer.WriteString(fmt.Sprintf("\t%s: %s\n", permissions.PermissionsList[perm].Name, permissions.PermissionsList[perm].Description))
+		direct = append(direct, permissions.PermissionsList[perm].Name)
+		buffer.WriteString(fmt.Sprintf("\t%s: %s", permissions.PermissionsList[perm].Name, permissions.PermissionsList[perm].Description))
+		if channels := scopeOf(permissions.PermissionsList[perm].Name, user); len(channels) > 0 {
+			buffer.WriteString(fmt.Sprintf(" (only in %s)", channelMentions(channels)))
+		}
+		buffer.WriteString("\n")
+	}
+
+	groups := expandGroups(direct, func(string) bool { return true })
+	if len(groups) == len(direct) {
+		return fmt.Sprintf("```%s```", buffer.String())
+	}
+
+	all, err := permsClient.ListPermissions(ctx, &permsrv.NilRequest{})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	buffer.WriteString("Inherited Permission Groups:\n")
+	for _, perm := range all.PermissionsList {
+		if via, ok := groups[perm.Name]; ok && via != "" {
+			buffer.WriteString(fmt.Sprintf("\t%s: %s (%s)\n", perm.Name, perm.Description, strings.TrimSpace(inheritanceChain(groups, perm.Name))))
+		}
 	}
 
 	return fmt.Sprintf("```%s```", buffer.String())
 }
 
-func NewCommand(name string, factory ClientFactory) *Command {
+func NewCommand(name string, factory ClientFactory, s Settings, l *zap.Logger) (*Command, error) {
+	var err error
+
 	clientFactory = factory
+	logger = l
+	settings = s
+	if err = settings.validate(); err != nil {
+		return nil, err
+	}
+
+	store, err = loadState(settings.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
 	role = rclient.Roles{
-		RoleClient:  clientFactory.NewRolesClient(),
+		RoleClient: clientFactory.NewRolesClient(),
 	}
-	perms = pclient.NewPermission(clientFactory.NewPermsClient(), []string{"perms_admins"})
-	serverPerms = pclient.NewPermission(clientFactory.NewPermsClient(), []string{"server_admins"})
-	return &Command{name: name, factory: factory}
+	createPerms = newPermission(clientFactory.NewPermsClient(), settings.Create)
+	destroyPerms = newPermission(clientFactory.NewPermsClient(), settings.Destroy)
+	membershipPerms = newPermission(clientFactory.NewPermsClient(), settings.Membership)
+	serverPerms = newPermission(clientFactory.NewPermsClient(), []string{"server_admins"})
+	auditorPerms = newPermission(clientFactory.NewPermsClient(), settings.readers())
+
+	go runJobs()
+
+	return &Command{name: name, factory: factory}, nil
 }
@@ -0,0 +1,129 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+)
+
+const diffUsage = "Usage: !perms diff <user> <other_user> [--copy]"
+
+// diffUsers compares the groups two users hold, optionally giving the
+// second user every group only the first has.
+func diffUsers(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 4 && (len(req.Args) != 5 || req.Args[4] != "--copy") {
+		return common.SendError(diffUsage)
+	}
+
+	if !common.IsDiscordUser(req.Args[2]) || !common.IsDiscordUser(req.Args[3]) {
+		return common.SendError(diffUsage)
+	}
+
+	from, to := common.ExtractUserId(req.Args[2]), common.ExtractUserId(req.Args[3])
+	copying := len(req.Args) == 5
+
+	permsClient := clientFactory.NewPermsClient()
+	held := make(map[string]map[string]bool)
+	for _, user := range []string{from, to} {
+		permissions, err := permsClient.ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		held[user] = make(map[string]bool)
+		for _, perm := range permissions.PermissionsList {
+			held[user][perm.Name] = true
+		}
+	}
+
+	var onlyFrom, onlyTo, both []string
+	for group := range held[from] {
+		if held[to][group] {
+			both = append(both, group)
+		} else {
+			onlyFrom = append(onlyFrom, group)
+		}
+	}
+
+	for group := range held[to] {
+		if !held[from][group] {
+			onlyTo = append(onlyTo, group)
+		}
+	}
+
+	sort.Strings(onlyFrom)
+	sort.Strings(onlyTo)
+	sort.Strings(both)
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var buffer bytes.Buffer
+	for _, section := range []struct {
+		title  string
+		groups []string
+	}{
+		{fmt.Sprintf("Only %s", userName(names, from)), onlyFrom},
+		{fmt.Sprintf("Only %s", userName(names, to)), onlyTo},
+		{"Both", both},
+	} {
+		buffer.WriteString(fmt.Sprintf("%s:\n", section.title))
+		for _, group := range section.groups {
+			buffer.WriteString(fmt.Sprintf("\t%s\n", group))
+		}
+	}
+
+	if !copying {
+		return fmt.Sprintf("```%s```", buffer.String())
+	}
+
+	// Archived groups can't gain members and linked ones would drop them again on the next sync
+	var changes []operation
+	var skipped []string
+	for _, group := range onlyFrom {
+		var linked bool
+		store.view(func(st *state) {
+			_, linked = st.Links[group]
+		})
+
+		if linked || lifecycleOf(group) == lifecycleArchived {
+			skipped = append(skipped, group)
+			continue
+		}
+
+		changes = append(changes, operation{Action: "add", Group: group, User: to, Channels: scopeOf(group, from)})
+	}
+
+	if len(changes) == 0 {
+		return common.SendError(fmt.Sprintf("%s has nothing to copy to %s", userName(names, from), userName(names, to)))
+	}
+
+	if msg := authorizeChanges(ctx, req, changes); msg != "" {
+		return msg
+	}
+
+	if !isConfirmed(ctx) {
+		buffer.WriteString(fmt.Sprintf("Copying gives %s %d groups:\n", userName(names, to), len(changes)))
+		for _, change := range changes {
+			buffer.WriteString(fmt.Sprintf("\t%s\n", change))
+		}
+		for _, group := range skipped {
+			buffer.WriteString(fmt.Sprintf("\tskipping %s, it's archived or linked to role-srv\n", group))
+		}
+
+		return requestConfirmation(ctx, req, buffer.String())
+	}
+
+	id, err := applyChanges(ctx, req, changes, 0)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Gave %s %d groups from %s as change %d\n", userName(names, to), len(changes), userName(names, from), id))
+}
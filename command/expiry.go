@@ -0,0 +1,102 @@
+package command
+
+import (
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"time"
+)
+
+// runExpiries warns the members of temporary groups that are about to expire
+// and destroys the ones that have. The destroy is applied like any other, so
+// the final membership is kept in the audit trail and the group can be restored.
+func runExpiries(ctx context.Context) {
+	expiring := make(map[string]groupInfo)
+	store.view(func(st *state) {
+		for group, info := range st.Groups {
+			if !info.Expires.IsZero() {
+				expiring[group] = info
+			}
+		}
+	})
+
+	for group, info := range expiring {
+		var err error
+		switch {
+		case !time.Now().Before(info.Expires):
+			err = expireGroup(ctx, group)
+		case !info.Notified && time.Until(info.Expires) <= settings.expiryNotice():
+			err = warnExpiry(ctx, group, info)
+		}
+
+		if err != nil {
+			logger.Error("Unable to expire group", zap.String("group", group), zap.Error(err))
+		}
+	}
+}
+
+func warnExpiry(ctx context.Context, group string, info groupInfo) error {
+	users, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: group})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("'%s' expires at %s UTC and you'll lose what it grants", group, info.Expires.UTC().Format("2006-01-02 15:04"))
+	if err = notify(users.UserList, message); err != nil {
+		return err
+	}
+
+	logger.Info("Warned members of expiring group", zap.String("group", group), zap.Int("members", len(users.UserList)))
+
+	// Nobody should be added to a group that's on its way out
+	return updateGroup(group, func(info *groupInfo) {
+		info.Notified = true
+		info.Lifecycle = lifecycleArchived
+	})
+}
+
+func expireGroup(ctx context.Context, group string) error {
+	perm, err := findPermission(ctx, group)
+	if err != nil {
+		return err
+	}
+
+	// Somebody got there first
+	if perm == nil {
+		return updateGroup(group, func(info *groupInfo) {
+			*info = groupInfo{}
+		})
+	}
+
+	users, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: group})
+	if err != nil {
+		return err
+	}
+
+	change, err := destroyOperation(ctx, group, users.UserList)
+	if err != nil {
+		return err
+	}
+
+	req := &proto.ExecRequest{Sender: systemSender, Args: []string{cmdName, "expire", group}}
+	id, err := applyChanges(ctx, req, []operation{change}, 0)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Expired group", zap.String("group", group), zap.Int("audit", id), zap.Int("members", len(users.UserList)))
+
+	return notify(users.UserList, fmt.Sprintf("'%s' has expired and you are no longer a member", group))
+}
+
+// expiryNote describes when group expires, for adding to listings.
+func expiryNote(group string) string {
+	info := groupInfoOf(group)
+	if info.Expires.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf(" (expires %s UTC)", info.Expires.UTC().Format("2006-01-02 15:04"))
+}
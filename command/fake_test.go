@@ -0,0 +1,147 @@
+package command
+
+import (
+	"errors"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	rolesrv "github.com/chremoas/role-srv/proto"
+	"github.com/micro/go-micro/client"
+	"golang.org/x/net/context"
+	"sort"
+	"testing"
+)
+
+// fakePerms is perms-srv with its groups, and their members, held in memory.
+type fakePerms struct {
+	groups map[string][]string
+}
+
+func (f *fakePerms) Perform(ctx context.Context, in *permsrv.PermissionsRequest, opts ...client.CallOption) (*permsrv.PerformResponse, error) {
+	for _, group := range in.PermissionsList {
+		if f.holds(in.User, group) {
+			return &permsrv.PerformResponse{CanPerform: true}, nil
+		}
+	}
+
+	return &permsrv.PerformResponse{}, nil
+}
+
+func (f *fakePerms) AddPermission(ctx context.Context, in *permsrv.Permission, opts ...client.CallOption) (*permsrv.Permission, error) {
+	if _, ok := f.groups[in.Name]; ok {
+		return nil, errors.New("permission already exists")
+	}
+
+	f.groups[in.Name] = []string{}
+	return in, nil
+}
+
+func (f *fakePerms) AddPermissionUser(ctx context.Context, in *permsrv.PermissionUser, opts ...client.CallOption) (*permsrv.PermissionUser, error) {
+	if _, ok := f.groups[in.Permission]; !ok {
+		return nil, errors.New("no such permission")
+	}
+
+	if !f.holds(in.User, in.Permission) {
+		f.groups[in.Permission] = append(f.groups[in.Permission], in.User)
+	}
+	return in, nil
+}
+
+func (f *fakePerms) RemovePermission(ctx context.Context, in *permsrv.Permission, opts ...client.CallOption) (*permsrv.Permission, error) {
+	delete(f.groups, in.Name)
+	return in, nil
+}
+
+func (f *fakePerms) RemovePermissionUser(ctx context.Context, in *permsrv.PermissionUser, opts ...client.CallOption) (*permsrv.PermissionUser, error) {
+	if !f.holds(in.User, in.Permission) {
+		return nil, errors.New("user isn't a member")
+	}
+
+	var members []string
+	for _, member := range f.groups[in.Permission] {
+		if member != in.User {
+			members = append(members, member)
+		}
+	}
+	f.groups[in.Permission] = members
+	return in, nil
+}
+
+func (f *fakePerms) ListPermissions(ctx context.Context, in *permsrv.NilRequest, opts ...client.CallOption) (*permsrv.PermissionsResponse, error) {
+	return &permsrv.PermissionsResponse{PermissionsList: f.list(func(string) bool { return true })}, nil
+}
+
+func (f *fakePerms) ListPermissionUsers(ctx context.Context, in *permsrv.UsersRequest, opts ...client.CallOption) (*permsrv.UsersResponse, error) {
+	return &permsrv.UsersResponse{UserList: append([]string(nil), f.groups[in.Permission]...)}, nil
+}
+
+func (f *fakePerms) ListUserPermissions(ctx context.Context, in *permsrv.PermissionUser, opts ...client.CallOption) (*permsrv.PermissionsResponse, error) {
+	return &permsrv.PermissionsResponse{PermissionsList: f.list(func(group string) bool { return f.holds(in.User, group) })}, nil
+}
+
+// holds reports whether user is a member of group.
+func (f *fakePerms) holds(user, group string) bool {
+	for _, member := range f.groups[group] {
+		if member == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *fakePerms) list(keep func(group string) bool) []*permsrv.Permission {
+	var list []*permsrv.Permission
+	for group := range f.groups {
+		if keep(group) {
+			list = append(list, &permsrv.Permission{Name: group})
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// fakeRoles answers the user lookups perms-cmd makes of role-srv, naming
+// every user after their id.
+type fakeRoles struct {
+	rolesrv.RolesService
+}
+
+func (fakeRoles) GetDiscordUser(ctx context.Context, in *rolesrv.GetDiscordUserRequest, opts ...client.CallOption) (*rolesrv.GetDiscordUserResponse, error) {
+	return &rolesrv.GetDiscordUserResponse{Id: in.UserId, Username: in.UserId}, nil
+}
+
+func (fakeRoles) GetDiscordUserList(ctx context.Context, in *rolesrv.NilMessage, opts ...client.CallOption) (*rolesrv.GetDiscordUserListResponse, error) {
+	return &rolesrv.GetDiscordUserListResponse{}, nil
+}
+
+type fakeFactory struct {
+	perms *fakePerms
+}
+
+func (f fakeFactory) NewPermsClient() permsrv.PermissionsService { return f.perms }
+
+func (f fakeFactory) NewRolesClient() rolesrv.RolesService { return fakeRoles{} }
+
+func (f fakeFactory) CommandMetadata(command string) (map[string]string, error) { return nil, nil }
+
+func (f fakeFactory) ListCommands() ([]string, error) { return nil, nil }
+
+// useFakePerms points perms-cmd at a fake perms-srv holding groups, and
+// builds the admin checks from the current settings.
+func useFakePerms(t *testing.T, groups map[string][]string) *fakePerms {
+	t.Helper()
+
+	perms := &fakePerms{groups: make(map[string][]string)}
+	for group, members := range groups {
+		perms.groups[group] = append([]string{}, members...)
+	}
+
+	clientFactory = fakeFactory{perms: perms}
+	createPerms = newPermission(perms, settings.Create)
+	destroyPerms = newPermission(perms, settings.Destroy)
+	membershipPerms = newPermission(perms, settings.Membership)
+	serverPerms = newPermission(perms, []string{"server_admins"})
+	auditorPerms = newPermission(perms, settings.readers())
+
+	return perms
+}
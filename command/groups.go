@@ -0,0 +1,145 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"sort"
+	"time"
+)
+
+// groupInfo is what perms-cmd knows about a permission group beyond its name and description.
+type groupInfo struct {
+	// Expires is when a temporary group is destroyed, zero for a permanent one
+	Expires time.Time `json:"expires"`
+
+	// Notified is set once the members have been told the group is about to expire
+	Notified bool `json:"notified,omitempty"`
+
+	// Lifecycle is active (empty), deprecated or archived
+	Lifecycle string `json:"lifecycle,omitempty"`
+
+	// Replacement is the group members of a deprecated group should move to
+	Replacement string `json:"replacement,omitempty"`
+
+	// Includes are the groups every member of this group holds as well
+	Includes []string `json:"includes,omitempty"`
+
+	// Joinable groups can be joined and left by anybody holding all of Requires,
+	// until they have Cap members when Cap isn't zero
+	Joinable bool     `json:"joinable,omitempty"`
+	Requires []string `json:"requires,omitempty"`
+	Cap      int      `json:"cap,omitempty"`
+}
+
+// empty reports whether there's nothing worth keeping about the group.
+func (g groupInfo) empty() bool {
+	return g.Expires.IsZero() && !g.Notified && g.Lifecycle == "" && g.Replacement == "" && len(g.Includes) == 0 &&
+		!g.Joinable && len(g.Requires) == 0 && g.Cap == 0
+}
+
+func groupInfoOf(group string) groupInfo {
+	var info groupInfo
+	store.view(func(st *state) {
+		info = st.Groups[group]
+	})
+
+	return info
+}
+
+// updateGroup calls f with what perms-cmd knows about group and saves the result.
+func updateGroup(group string, f func(info *groupInfo)) error {
+	return store.update(func(st *state) {
+		info := st.Groups[group]
+		f(&info)
+
+		if info.empty() {
+			delete(st.Groups, group)
+		} else {
+			st.Groups[group] = info
+		}
+	})
+}
+
+// notify leaves message for each of users, to be shown the next time they use perms-cmd.
+func notify(users []string, message string) error {
+	return store.update(func(st *state) {
+		for _, user := range users {
+			st.Notices[user] = append(st.Notices[user], message)
+		}
+	})
+}
+
+// listNotices shows auditors the notices nobody has picked up yet, since
+// perms-cmd can only hand them over when their users next use it.
+func listNotices(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 2 {
+		return common.SendError("Usage: !perms notices")
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+		return msg
+	}
+
+	waiting := make(map[string][]string)
+	store.view(func(st *state) {
+		for user, notices := range st.Notices {
+			waiting[user] = notices
+		}
+	})
+
+	if len(waiting) == 0 {
+		return common.SendError("No notices waiting")
+	}
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var users []string
+	for user := range waiting {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return userName(names, users[i]) < userName(names, users[j]) })
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Waiting Notices:\n")
+	for _, user := range users {
+		for _, notice := range waiting[user] {
+			buffer.WriteString(fmt.Sprintf("\t%s: %s\n", userName(names, user), notice))
+		}
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// takeNotices returns the messages waiting for user and forgets them.
+func takeNotices(user string) []string {
+	var waiting bool
+	store.view(func(st *state) {
+		waiting = len(st.Notices[user]) > 0
+	})
+
+	if !waiting {
+		return nil
+	}
+
+	var notices []string
+	err := store.update(func(st *state) {
+		notices = st.Notices[user]
+		delete(st.Notices, user)
+	})
+	if err != nil {
+		logger.Error("Unable to clear notices", zap.String("user", user), zap.Error(err))
+	}
+
+	return notices
+}
@@ -0,0 +1,251 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+const impactUsage = "Usage: !perms impact <group>|<user> [<group>]"
+
+// commandRequirement ties a command, or one of its subcommands, to the groups that can run it.
+type commandRequirement struct {
+	Command    string
+	Subcommand string
+
+	// Groups are the checks the command makes, somebody needs one group from each
+	Groups [][]string
+}
+
+func (c commandRequirement) String() string {
+	if c.Subcommand == "" {
+		return "!" + c.Command
+	}
+
+	return fmt.Sprintf("!%s %s", c.Command, c.Subcommand)
+}
+
+// knownCommands gathers every command requirement perms-cmd knows about, from
+// the registry, perms-cmd itself and the configuration, in increasing precedence.
+func knownCommands() []commandRequirement {
+	known := make(map[string]commandRequirement)
+
+	// The registry is a nice to have, perms-cmd's own commands still tell us plenty
+	commands, err := clientFactory.ListCommands()
+	if err != nil {
+		logger.Warn("Unable to list commands", zap.Error(err))
+	}
+
+	for _, command := range commands {
+		metadata, err := clientFactory.CommandMetadata(command)
+		if err != nil {
+			logger.Warn("Unable to read command metadata", zap.String("command", command), zap.Error(err))
+			continue
+		}
+
+		for key := range metadata {
+			if key != metadataPrefix && !strings.HasPrefix(key, metadataPrefix+".") {
+				continue
+			}
+
+			subcommand := strings.TrimPrefix(strings.TrimPrefix(key, metadataPrefix), ".")
+			need, err := requiredGroups(command, subcommand)
+			if err != nil {
+				continue
+			}
+
+			c := commandRequirement{Command: command, Subcommand: subcommand, Groups: need.Groups}
+			known[c.String()] = c
+		}
+	}
+
+	for subcommand := range ownNeeds {
+		c := commandRequirement{Command: cmdName, Subcommand: subcommand, Groups: ownRequirement(subcommand).Groups}
+		known[c.String()] = c
+	}
+
+	for key, groups := range settings.Commands {
+		s := strings.SplitN(key, " ", 2)
+		c := commandRequirement{Command: s[0], Groups: oneOf(groups)}
+		if len(s) == 2 {
+			c.Subcommand = s[1]
+		}
+		known[c.String()] = c
+	}
+
+	var list []commandRequirement
+	for _, c := range known {
+		if len(c.Groups) > 0 {
+			list = append(list, c)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+	return list
+}
+
+// adminGroups are the groups that let somebody change or review permissions.
+func adminGroups() []string {
+	return append(settings.readers(), "server_admins")
+}
+
+// holdsAll reports whether groups get through every one of checks.
+func holdsAll(groups map[string]string, checks [][]string) bool {
+	for _, check := range checks {
+		if !holdsAny(groups, check) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func holdsAny(groups map[string]string, wanted []string) bool {
+	for _, group := range wanted {
+		if _, ok := groups[group]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func impact(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 3 || len(req.Args) > 4 {
+		return common.SendError(impactUsage)
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+		return msg
+	}
+
+	permsClient := clientFactory.NewPermsClient()
+
+	// A group on its own is destroyed, everybody holding it through an include loses it too
+	if !common.IsDiscordUser(req.Args[2]) {
+		if len(req.Args) != 3 {
+			return common.SendError(impactUsage)
+		}
+
+		group := req.Args[2]
+		removals := make(map[string][]string)
+		for _, granting := range grantingGroups([]string{group}) {
+			users, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: granting})
+			if err != nil {
+				return common.SendFatal(err.Error())
+			}
+
+			for _, user := range users.UserList {
+				if granting == group {
+					removals[user] = []string{group}
+				} else if _, ok := removals[user]; !ok {
+					removals[user] = nil
+				}
+			}
+		}
+
+		return impactReport(ctx, fmt.Sprintf("Destroying '%s'", group), removals, group)
+	}
+
+	user := common.ExtractUserId(req.Args[2])
+	if len(req.Args) == 4 {
+		return impactReport(ctx, fmt.Sprintf("Removing them from '%s'", req.Args[3]), map[string][]string{user: {req.Args[3]}}, "")
+	}
+
+	// Just a user is an offboarding, every group goes
+	permissions, err := permsClient.ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var groups []string
+	for _, perm := range permissions.PermissionsList {
+		groups = append(groups, perm.Name)
+	}
+
+	return impactReport(ctx, "Offboarding them", map[string][]string{user: groups}, "")
+}
+
+// impactReport describes which commands each user would lose if they left
+// the groups in removals and destroyed was gone, and who would be left with
+// no way to administer permissions at all.
+func impactReport(ctx context.Context, title string, removals map[string][]string, destroyed string) string {
+	commands := knownCommands()
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var users []string
+	for user := range removals {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return userName(names, users[i]) < userName(names, users[j]) })
+
+	var buffer bytes.Buffer
+	var affected int
+	buffer.WriteString(fmt.Sprintf("%s would affect:\n", title))
+	for _, user := range users {
+		permissions, err := clientFactory.NewPermsClient().ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		var direct, remaining []string
+		for _, perm := range permissions.PermissionsList {
+			direct = append(direct, perm.Name)
+			if !contains(removals[user], perm.Name) {
+				remaining = append(remaining, perm.Name)
+			}
+		}
+
+		before := expandGroups(direct, func(string) bool { return true })
+		after := expandGroups(remaining, func(group string) bool { return group != destroyed })
+
+		var lost []string
+		for _, c := range commands {
+			if holdsAll(before, c.Groups) && !holdsAll(after, c.Groups) {
+				lost = append(lost, c.String())
+			}
+		}
+
+		var lostGroups []string
+		for group := range before {
+			if _, ok := after[group]; !ok {
+				lostGroups = append(lostGroups, group)
+			}
+		}
+		sort.Strings(lostGroups)
+
+		if len(lostGroups) == 0 {
+			continue
+		}
+
+		affected++
+		buffer.WriteString(fmt.Sprintf("\t%s loses %s\n", userName(names, user), strings.Join(lostGroups, ", ")))
+		if len(lost) > 0 {
+			buffer.WriteString(fmt.Sprintf("\t\tand can no longer run %s\n", strings.Join(lost, ", ")))
+		}
+
+		if holdsAny(before, adminGroups()) && !holdsAny(after, adminGroups()) {
+			buffer.WriteString("\t\tand is left with no admin path at all\n")
+		}
+	}
+
+	if affected == 0 {
+		return common.SendSuccess(fmt.Sprintf("%s wouldn't take anything away from anybody\n", title))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	rolesrv "github.com/chremoas/role-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// dryRunnable are the subcommands that only change anything through
+// applyChanges or a pending change, so a dry run can't leave a mark.
+var dryRunnable = []string{
+	"list", "list_users", "list_user_perms", "mine", "export", "whois", "who_can", "check", "impact", "diff", "pending",
+	"audit", "tree", "create", "destroy", "restore", "add", "remove", "offboard", "batch", "migrate", "revert", "undo",
+	"join", "leave",
+}
+
+// actAs runs a subcommand as though another user had sent it from this
+// channel, without changing anything, to see what they'd get.
+func actAs(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 4 || !common.IsDiscordUser(req.Args[2]) {
+		return common.SendError("Usage: !perms as <user> <subcommand> [<arguments>]")
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+		return msg
+	}
+
+	user, subcommand := common.ExtractUserId(req.Args[2]), req.Args[3]
+	if !contains(dryRunnable, subcommand) {
+		return common.SendError(fmt.Sprintf("`%s` can't be tried as somebody else, try one of %s", subcommand, strings.Join(dryRunnable, ", ")))
+	}
+
+	u, err := clientFactory.NewRolesClient().GetDiscordUser(ctx, &rolesrv.GetDiscordUserRequest{UserId: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	channel := strings.Split(req.Sender, ":")[0]
+	as := &proto.ExecRequest{Sender: channel + ":" + user, Args: append([]string{req.Args[0]}, req.Args[3:]...)}
+
+	return fmt.Sprintf("As %s, nothing is changed:\n%s", u.Username, run(context.WithValue(ctx, dryRunKey, true), as))
+}
@@ -0,0 +1,356 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+// includesOf returns the groups that members of group hold as well.
+func includesOf(group string) []string {
+	return groupInfoOf(group).Includes
+}
+
+// expandGroups follows the includes of the direct groups, mapping every group
+// reached to the group it was included by, or "" for the direct ones. Groups
+// that aren't active don't pass anything on.
+func expandGroups(direct []string, active func(group string) bool) map[string]string {
+	groups := make(map[string]string)
+	var queue []string
+
+	for _, group := range direct {
+		if _, seen := groups[group]; !seen && active(group) {
+			groups[group] = ""
+			queue = append(queue, group)
+		}
+	}
+
+	for len(queue) > 0 {
+		group := queue[0]
+		queue = queue[1:]
+
+		for _, included := range includesOf(group) {
+			if _, seen := groups[included]; !seen && active(included) {
+				groups[included] = group
+				queue = append(queue, included)
+			}
+		}
+	}
+
+	return groups
+}
+
+// reachableGroups returns group and every group its members hold through it,
+// whether or not their windows are open.
+func reachableGroups(group string) []string {
+	return sortedKeys(expandGroups([]string{group}, func(string) bool { return true }))
+}
+
+// effectiveGroups returns the groups user holds right now from channel, directly
+// or through includes. Grants scoped to channels don't count when channel is "".
+func effectiveGroups(ctx context.Context, user, channel string) (map[string]string, error) {
+	permissions, err := clientFactory.NewPermsClient().ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+	if err != nil {
+		return nil, err
+	}
+
+	var direct []string
+	for _, perm := range permissions.PermissionsList {
+		if inScope(perm.Name, user, channel) {
+			direct = append(direct, perm.Name)
+		}
+	}
+
+	return expandGroups(direct, windowOpen), nil
+}
+
+// inheritanceChain describes how group was reached in groups, e.g. "via sig_admins via perms_admins".
+func inheritanceChain(groups map[string]string, group string) string {
+	var buffer bytes.Buffer
+	for via := groups[group]; via != ""; via = groups[via] {
+		buffer.WriteString(fmt.Sprintf(" via %s", via))
+	}
+
+	return buffer.String()
+}
+
+// includedBy returns the groups that directly include group.
+func includedBy(group string) []string {
+	var parents []string
+	store.view(func(st *state) {
+		for parent, info := range st.Groups {
+			for _, included := range info.Includes {
+				if included == group {
+					parents = append(parents, parent)
+				}
+			}
+		}
+	})
+
+	sort.Strings(parents)
+	return parents
+}
+
+// ancestorGroups returns group and every group whose members hold it through includes.
+func ancestorGroups(group string) []string {
+	seen := map[string]bool{group: true}
+	queue := []string{group}
+	for i := 0; i < len(queue); i++ {
+		for _, parent := range includedBy(queue[i]) {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return queue
+}
+
+func without(list []string, value string) []string {
+	var result []string
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func includeGroup(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 4 {
+		return common.SendError(fmt.Sprintf("Usage: !perms %s <group> <included_group>", req.Args[1]))
+	}
+
+	group, included := req.Args[2], req.Args[3]
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, createPerms); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+		return msg
+	}
+
+	if req.Args[1] == "exclude" {
+		info := groupInfoOf(group)
+		if len(without(info.Includes, included)) == len(info.Includes) {
+			return common.SendError(fmt.Sprintf("'%s' doesn't include '%s'", group, included))
+		}
+
+		err := updateGroup(group, func(info *groupInfo) {
+			info.Includes = without(info.Includes, included)
+		})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		return common.SendSuccess(fmt.Sprintf("Members of '%s' no longer hold '%s' through it\n", group, included))
+	}
+
+	if group == included {
+		return common.SendError("A group can't include itself")
+	}
+
+	for _, name := range []string{group, included} {
+		perm, err := findPermission(ctx, name)
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		if perm == nil {
+			return common.SendError(fmt.Sprintf("'%s' doesn't exist", name))
+		}
+	}
+
+	if _, loop := expandGroups([]string{included}, func(string) bool { return true })[group]; loop {
+		return common.SendError(fmt.Sprintf("'%s' already includes '%s', groups can't include each other", included, group))
+	}
+
+	for _, existing := range includesOf(group) {
+		if existing == included {
+			return common.SendError(fmt.Sprintf("'%s' already includes '%s'", group, included))
+		}
+	}
+
+	// Including a group hands all it reaches to every member, so it's guarded like adding them would be
+	reachable := reachableGroups(included)
+	for _, g := range reachable {
+		if contains(settings.readers(), g) {
+			return common.SendError(fmt.Sprintf("'%s' grants admin rights, add people to it directly instead", g))
+		}
+	}
+
+	var protected string
+	for _, g := range reachable {
+		if isProtected(g) {
+			protected = g
+			break
+		}
+	}
+
+	// Nobody vets who joins, rotates into or follows role-srv into these
+	for _, g := range ancestorGroups(group) {
+		var linked, rotates bool
+		store.view(func(st *state) {
+			_, linked = st.Links[g]
+			_, rotates = st.Rotations[g]
+		})
+
+		switch {
+		case groupInfoOf(g).Joinable:
+			return common.SendError(fmt.Sprintf("Anybody can join '%s', so it can't include other groups", g))
+		case protected != "" && (linked || rotates):
+			return common.SendError(fmt.Sprintf("'%s' is linked to role-srv or rotates, so it can't include protected '%s'", g, protected))
+		}
+	}
+
+	if protected != "" || contains(reachable, "perms_admins") {
+		if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+			return msg
+		}
+	}
+
+	if protected != "" {
+		// Including into a group the sender holds is changing their own membership
+		sender := senderId(req.Sender)
+		held, err := clientFactory.NewPermsClient().ListUserPermissions(ctx, &permsrv.PermissionUser{User: sender})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		ancestors := ancestorGroups(group)
+		for _, perm := range held.PermissionsList {
+			if !contains(ancestors, perm.Name) {
+				continue
+			}
+
+			for _, g := range reachable {
+				if msg := checkSelfModification(ctx, req, sender, g); msg != "" {
+					return msg
+				}
+			}
+		}
+	}
+
+	if settings.TwoPersonRule && !isConfirmed(ctx) && protected != "" {
+		return requestApproval(ctx, req, fmt.Sprintf("Changes to '%s' need approval", protected))
+	}
+
+	if isDryRun(ctx) {
+		return common.SendSuccess(fmt.Sprintf("Members of '%s' would hold '%s' as well\n", group, included))
+	}
+
+	err := updateGroup(group, func(info *groupInfo) {
+		info.Includes = append(info.Includes, included)
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Members of '%s' now hold '%s' as well\n", group, included))
+}
+
+func groupTree(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) > 3 {
+		return common.SendError("Usage: !perms tree [group]")
+	}
+
+	var roots []string
+	if len(req.Args) == 3 {
+		roots = []string{req.Args[2]}
+	} else {
+		store.view(func(st *state) {
+			for group, info := range st.Groups {
+				if len(info.Includes) > 0 {
+					roots = append(roots, group)
+				}
+			}
+		})
+
+		var top []string
+		for _, group := range roots {
+			if len(includedBy(group)) == 0 {
+				top = append(top, group)
+			}
+		}
+		roots = top
+	}
+
+	if len(roots) == 0 {
+		return common.SendError("No groups include other groups")
+	}
+
+	sort.Strings(roots)
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Permission Groups:\n")
+	for _, group := range roots {
+		writeTree(&buffer, group, 1)
+		if len(req.Args) == 3 {
+			if parents := includedBy(group); len(parents) > 0 {
+				buffer.WriteString(fmt.Sprintf("Included by: %s\n", strings.Join(parents, ", ")))
+			}
+		}
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func writeTree(buffer *bytes.Buffer, group string, depth int) {
+	for i := 0; i < depth; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString(group + lifecycleNote(group) + "\n")
+
+	for _, included := range includesOf(group) {
+		writeTree(buffer, included, depth+1)
+	}
+}
+
+// EffectivePermissions answers the same questions as perms-srv, taking the
+// includes, channel scopes and windows perms-cmd manages into account. Other
+// services can call it as EffectivePermissions.Perform and
+// EffectivePermissions.ListUserPermissions on this service. There is no
+// channel in these requests, so grants scoped to channels don't count.
+type EffectivePermissions struct{}
+
+func (e *EffectivePermissions) Perform(ctx context.Context, req *permsrv.PermissionsRequest, rsp *permsrv.PerformResponse) error {
+	canPerform, err := newPermission(clientFactory.NewPermsClient(), req.PermissionsList).CanPerform(ctx, ":"+req.User)
+	if err != nil {
+		return err
+	}
+
+	rsp.CanPerform = canPerform
+	return nil
+}
+
+func (e *EffectivePermissions) ListUserPermissions(ctx context.Context, req *permsrv.PermissionUser, rsp *permsrv.PermissionsResponse) error {
+	groups, err := effectiveGroups(ctx, req.User, "")
+	if err != nil {
+		return err
+	}
+
+	permissions, err := clientFactory.NewPermsClient().ListPermissions(ctx, &permsrv.NilRequest{})
+	if err != nil {
+		return err
+	}
+
+	for _, perm := range permissions.PermissionsList {
+		if _, ok := groups[perm.Name]; ok {
+			rsp.PermissionsList = append(rsp.PermissionsList, perm)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandGroups(t *testing.T) {
+	all := func(string) bool { return true }
+
+	tests := []struct {
+		name     string
+		includes map[string][]string
+		direct   []string
+		active   func(group string) bool
+		want     map[string]string
+	}{
+		{
+			name:   "no includes",
+			direct: []string{"fcs", "scouts"},
+			active: all,
+			want:   map[string]string{"fcs": "", "scouts": ""},
+		},
+		{
+			name:     "chain",
+			includes: map[string][]string{"perms_admins": {"sig_admins"}, "sig_admins": {"role_admins"}},
+			direct:   []string{"perms_admins"},
+			active:   all,
+			want:     map[string]string{"perms_admins": "", "sig_admins": "perms_admins", "role_admins": "sig_admins"},
+		},
+		{
+			name:     "cycle",
+			includes: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			direct:   []string{"a"},
+			active:   all,
+			want:     map[string]string{"a": "", "b": "a", "c": "b"},
+		},
+		{
+			name:     "direct beats included",
+			includes: map[string][]string{"a": {"b"}},
+			direct:   []string{"a", "b"},
+			active:   all,
+			want:     map[string]string{"a": "", "b": ""},
+		},
+		{
+			name:     "shortest route",
+			includes: map[string][]string{"a": {"b", "c"}, "b": {"c"}},
+			direct:   []string{"a"},
+			active:   all,
+			want:     map[string]string{"a": "", "b": "a", "c": "a"},
+		},
+		{
+			name:     "inactive groups pass nothing on",
+			includes: map[string][]string{"a": {"b"}, "b": {"c"}},
+			direct:   []string{"a"},
+			active:   func(group string) bool { return group != "b" },
+			want:     map[string]string{"a": ""},
+		},
+		{
+			name:     "inactive direct group",
+			includes: map[string][]string{"a": {"b"}},
+			direct:   []string{"a", "c"},
+			active:   func(group string) bool { return group != "a" },
+			want:     map[string]string{"c": ""},
+		},
+		{
+			name:     "reached another way",
+			includes: map[string][]string{"a": {"b"}, "c": {"d"}, "d": {"b"}},
+			direct:   []string{"a", "c"},
+			active:   func(group string) bool { return group != "a" },
+			want:     map[string]string{"c": "", "d": "c", "b": "d"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestState(t)
+			for group, includes := range test.includes {
+				includes := includes
+				if err := updateGroup(group, func(info *groupInfo) { info.Includes = includes }); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := expandGroups(test.direct, test.active); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expandGroups(%q) = %v, want %v", test.direct, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReachableAndAncestorGroups(t *testing.T) {
+	useTestState(t)
+	for group, includes := range map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}, "d": {"b"}} {
+		includes := includes
+		if err := updateGroup(group, func(info *groupInfo) { info.Includes = includes }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := reachableGroups("d"), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reachableGroups(d) = %q, want %q", got, want)
+	}
+
+	if got, want := ancestorGroups("b"), []string{"b", "a", "d", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestorGroups(b) = %q, want %q", got, want)
+	}
+
+	if got, want := ancestorGroups("d"), []string{"d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestorGroups(d) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"golang.org/x/net/context"
+	"time"
+)
+
+// systemSender is who changes made by background jobs are recorded as coming from.
+var systemSender = "jobs:" + cmdName
+
+// jobs run in the background once a minute, in order.
+var jobs = []func(ctx context.Context){
+	runScheduled,
+	runRotations,
+	runLinks,
+	runWindows,
+	runExpiries,
+}
+
+func runJobs() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, job := range jobs {
+			job(context.Background())
+		}
+	}
+}
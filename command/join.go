@@ -0,0 +1,238 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const joinableUsage = "Usage: !perms joinable [<group> on [--requires <group>...] [--cap <members>]|<group> off]"
+
+// setJoinable lets anybody join and leave a low risk group without an admin,
+// the same way SIGs can be joinable in role-srv.
+func setJoinable(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) == 2 {
+		return listJoinable()
+	}
+
+	if len(req.Args) < 4 || (req.Args[3] != "on" && req.Args[3] != "off") || (req.Args[3] == "off" && len(req.Args) != 4) {
+		return common.SendError(joinableUsage)
+	}
+
+	group := req.Args[2]
+
+	var requires []string
+	var limit int
+	for i := 4; i < len(req.Args); i++ {
+		switch {
+		case req.Args[i] == "--cap" && i+1 < len(req.Args):
+			var err error
+			if limit, err = strconv.Atoi(req.Args[i+1]); err != nil || limit < 1 {
+				return common.SendError(joinableUsage)
+			}
+			i++
+		case req.Args[i] == "--requires":
+			for i+1 < len(req.Args) && !strings.HasPrefix(req.Args[i+1], "--") {
+				requires = append(requires, req.Args[i+1])
+				i++
+			}
+			if len(requires) == 0 {
+				return common.SendError(joinableUsage)
+			}
+		default:
+			return common.SendError(joinableUsage)
+		}
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, createPerms); msg != "" {
+		return msg
+	}
+
+	if req.Args[3] == "off" {
+		if !groupInfoOf(group).Joinable {
+			return common.SendError(fmt.Sprintf("'%s' isn't joinable", group))
+		}
+
+		err := updateGroup(group, func(info *groupInfo) {
+			info.Joinable, info.Requires, info.Cap = false, nil, 0
+		})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		return common.SendSuccess(fmt.Sprintf("'%s' can only be joined through an admin again, its members are left as they are\n", group))
+	}
+
+	for _, name := range append([]string{group}, requires...) {
+		perm, err := findPermission(ctx, name)
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		if perm == nil {
+			return common.SendError(fmt.Sprintf("'%s' doesn't exist", name))
+		}
+	}
+
+	if lifecycleOf(group) == lifecycleArchived {
+		return common.SendError(fmt.Sprintf("'%s' is archived", group))
+	}
+
+	// Anything admins guard, or that something else decides the membership of,
+	// stays closed, and joining a group hands out everything it includes as well
+	for _, g := range reachableGroups(group) {
+		var managed bool
+		store.view(func(st *state) {
+			_, linked := st.Links[g]
+			_, rotates := st.Rotations[g]
+			managed = linked || rotates
+		})
+
+		switch {
+		case g == "perms_admins" || g == "server_admins" || isProtected(g):
+			return common.SendError(fmt.Sprintf("'%s' is protected and can't be joinable", g))
+		case contains(settings.readers(), g):
+			return common.SendError(fmt.Sprintf("'%s' grants admin rights and can't be joinable", g))
+		case managed:
+			return common.SendError(fmt.Sprintf("'%s' is linked to role-srv or rotates, so its membership is already managed", g))
+		}
+	}
+
+	err := updateGroup(group, func(info *groupInfo) {
+		info.Joinable, info.Requires, info.Cap = true, requires, limit
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Anybody%s can now `!perms join %s`%s\n", requiresNote(requires), group, capNote(limit)))
+}
+
+func requiresNote(requires []string) string {
+	if len(requires) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" holding %s", strings.Join(requires, " and "))
+}
+
+func capNote(limit int) string {
+	if limit == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(", up to %d members", limit)
+}
+
+func listJoinable() string {
+	joinable := make(map[string]groupInfo)
+	store.view(func(st *state) {
+		for group, info := range st.Groups {
+			if info.Joinable && info.Lifecycle != lifecycleArchived {
+				joinable[group] = info
+			}
+		}
+	})
+
+	if len(joinable) == 0 {
+		return common.SendError("No joinable groups")
+	}
+
+	var groups []string
+	for group := range joinable {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Joinable Groups:\n")
+	for _, group := range groups {
+		buffer.WriteString(fmt.Sprintf("\t%s%s%s%s\n", group, requiresNote(joinable[group].Requires), capNote(joinable[group].Cap), lifecycleNote(group)))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// joinGroup adds or removes the sender from a joinable group.
+func joinGroup(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 {
+		return common.SendError(fmt.Sprintf("Usage: !perms %s <group>", req.Args[1]))
+	}
+
+	group, user := req.Args[2], senderId(req.Sender)
+	joining := req.Args[1] == "join"
+
+	info := groupInfoOf(group)
+	if !info.Joinable {
+		return common.SendError(fmt.Sprintf("'%s' isn't joinable, ask an admin, see `!perms joinable` for the groups that are", group))
+	}
+
+	permsClient := clientFactory.NewPermsClient()
+	users, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: group})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	member := contains(users.UserList, user)
+
+	if !joining {
+		if !member {
+			return common.SendError(fmt.Sprintf("You aren't in '%s'", group))
+		}
+
+		_, err = applyChanges(ctx, req, []operation{{Action: "remove", Group: group, User: user, Channels: scopeOf(group, user)}}, 0)
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		return common.SendSuccess(fmt.Sprintf("You left '%s'\n", group))
+	}
+
+	switch {
+	case member:
+		return common.SendError(fmt.Sprintf("You're already in '%s'", group))
+	case info.Lifecycle == lifecycleArchived:
+		return common.SendError(fmt.Sprintf("'%s' is archived and can't gain members", group))
+	case info.Cap > 0 && len(users.UserList) >= info.Cap:
+		return common.SendError(fmt.Sprintf("'%s' is full, it's limited to %d members", group, info.Cap))
+	}
+
+	if len(info.Requires) > 0 {
+		held, err := effectiveGroups(ctx, user, strings.Split(req.Sender, ":")[0])
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		var missing []string
+		for _, required := range info.Requires {
+			if _, ok := held[required]; !ok {
+				missing = append(missing, required)
+			}
+		}
+
+		if len(missing) > 0 {
+			return common.SendError(fmt.Sprintf("Joining '%s' needs %s first", group, strings.Join(missing, " and ")))
+		}
+	}
+
+	_, err = applyChanges(ctx, req, []operation{{Action: "add", Group: group, User: user}}, 0)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if info.Lifecycle == lifecycleDeprecated && info.Replacement != "" {
+		return common.SendSuccess(fmt.Sprintf("You joined '%s'\nWarning: it's deprecated, '%s' replaces it\n", group, info.Replacement))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("You joined '%s'\n", group))
+}
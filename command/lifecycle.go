@@ -0,0 +1,186 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+)
+
+const lifecycleUsage = "Usage: !perms lifecycle <group> [active|deprecated [<replacement>]|archived]"
+
+// Groups are active until they're deprecated in favour of a replacement, and
+// archived once nothing should use them. Neither removes the group from
+// perms-srv, so services still checking an old name keep working meanwhile.
+const (
+	lifecycleActive     = "active"
+	lifecycleDeprecated = "deprecated"
+	lifecycleArchived   = "archived"
+)
+
+func lifecycleOf(group string) string {
+	if lifecycle := groupInfoOf(group).Lifecycle; lifecycle != "" {
+		return lifecycle
+	}
+
+	return lifecycleActive
+}
+
+// lifecycleNote describes a group that isn't active, for adding to listings.
+func lifecycleNote(group string) string {
+	info := groupInfoOf(group)
+	switch {
+	case info.Lifecycle == lifecycleDeprecated && info.Replacement != "":
+		return fmt.Sprintf(" [deprecated, use %s]", info.Replacement)
+	case info.Lifecycle != "":
+		return fmt.Sprintf(" [%s]", info.Lifecycle)
+	}
+
+	return ""
+}
+
+func setLifecycle(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 3 || len(req.Args) > 5 {
+		return common.SendError(lifecycleUsage)
+	}
+
+	group := req.Args[2]
+	perm, err := findPermission(ctx, group)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if perm == nil {
+		return common.SendError(fmt.Sprintf("'%s' doesn't exist", group))
+	}
+
+	if len(req.Args) == 3 {
+		return common.SendSuccess(fmt.Sprintf("'%s' is %s%s\n", group, lifecycleOf(group), lifecycleNote(group)))
+	}
+
+	lifecycle := req.Args[3]
+	var replacement string
+	switch {
+	case lifecycle == lifecycleDeprecated && len(req.Args) == 5:
+		replacement = req.Args[4]
+	case (lifecycle == lifecycleActive || lifecycle == lifecycleDeprecated || lifecycle == lifecycleArchived) && len(req.Args) == 4:
+	default:
+		return common.SendError(lifecycleUsage)
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	// Archiving is the first step of retiring a group, so it's up to whoever may destroy them
+	required := createPerms
+	if lifecycle == lifecycleArchived {
+		required = destroyPerms
+	}
+
+	if msg := checkPermission(ctx, req.Sender, required); msg != "" {
+		return msg
+	}
+
+	if replacement != "" {
+		if replacement == group {
+			return common.SendError("A group can't replace itself")
+		}
+
+		perm, err := findPermission(ctx, replacement)
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		if perm == nil {
+			return common.SendError(fmt.Sprintf("'%s' doesn't exist", replacement))
+		}
+
+		if lifecycleOf(replacement) != lifecycleActive {
+			return common.SendError(fmt.Sprintf("'%s' is %s itself", replacement, lifecycleOf(replacement)))
+		}
+	}
+
+	err = updateGroup(group, func(info *groupInfo) {
+		info.Lifecycle, info.Replacement = lifecycle, replacement
+		if lifecycle == lifecycleActive {
+			info.Lifecycle = ""
+		}
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("'%s' is now %s%s\n", group, lifecycle, lifecycleNote(group)))
+}
+
+// migrateGroup moves everybody in a deprecated group to its replacement.
+func migrateGroup(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 {
+		return common.SendError("Usage: !perms migrate <deprecated_group>")
+	}
+
+	group := req.Args[2]
+	info := groupInfoOf(group)
+	if info.Lifecycle != lifecycleDeprecated || info.Replacement == "" {
+		return common.SendError(fmt.Sprintf("'%s' isn't deprecated in favour of another group, see `!perms lifecycle`", group))
+	}
+
+	permsClient := clientFactory.NewPermsClient()
+	users, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: group})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	members := users.UserList
+	for _, user := range stashedUsers(group) {
+		if !contains(members, user) {
+			members = append(members, user)
+		}
+	}
+
+	if len(members) == 0 {
+		return common.SendError(fmt.Sprintf("'%s' has no members to migrate", group))
+	}
+
+	existing, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: info.Replacement})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	already := make(map[string]bool)
+	for _, user := range existing.UserList {
+		already[user] = true
+	}
+
+	var changes []operation
+	for _, user := range members {
+		if !already[user] {
+			changes = append(changes, operation{Action: "add", Group: info.Replacement, User: user, Channels: memberChannels(group, user)})
+		}
+		changes = append(changes, operation{Action: "remove", Group: group, User: user, Channels: memberChannels(group, user)})
+	}
+
+	if msg := authorizeChanges(ctx, req, changes); msg != "" {
+		return msg
+	}
+
+	if !isConfirmed(ctx) {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Moving %d members from '%s' to '%s':\n", len(members), group, info.Replacement))
+		for _, change := range changes {
+			buffer.WriteString(fmt.Sprintf("\t%s\n", change))
+		}
+
+		return requestConfirmation(ctx, req, buffer.String())
+	}
+
+	id, err := applyChanges(ctx, req, changes, 0)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Moved %d members from '%s' to '%s' as change %d\n", len(members), group, info.Replacement, id))
+}
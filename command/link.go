@@ -0,0 +1,300 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	rolesrv "github.com/chremoas/role-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+const linkUsage = "Usage: !perms link [<group> filter:<name>|role:<name>]"
+
+// link keeps a group's membership the same as a role-srv filter or role.
+type link struct {
+	Group string `json:"group"`
+
+	// Source is filter:<name> or role:<name>
+	Source string `json:"source"`
+}
+
+// members returns who is in the filter or role the link follows.
+func (l link) members(ctx context.Context) ([]string, error) {
+	kind, name := splitSource(l.Source)
+	roleClient := clientFactory.NewRolesClient()
+
+	switch kind {
+	case "filter":
+		members, err := roleClient.GetMembers(ctx, &rolesrv.Filter{Name: name})
+		if err != nil {
+			return nil, err
+		}
+		return members.Members, nil
+	case "role":
+		members, err := roleClient.GetRoleMembership(ctx, &rolesrv.RoleMembershipRequest{Name: name})
+		if err != nil {
+			return nil, err
+		}
+		return members.Members, nil
+	}
+
+	return nil, fmt.Errorf("unknown link source: %s", l.Source)
+}
+
+func splitSource(source string) (string, string) {
+	s := strings.SplitN(source, ":", 2)
+	if len(s) != 2 {
+		return "", ""
+	}
+
+	return s[0], s[1]
+}
+
+func linkGroup(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) == 2 {
+		return listLinks()
+	}
+
+	if len(req.Args) != 4 {
+		return common.SendError(linkUsage)
+	}
+
+	group, source := req.Args[2], req.Args[3]
+	if kind, name := splitSource(source); (kind != "filter" && kind != "role") || name == "" {
+		return common.SendError(linkUsage)
+	}
+
+	if msg := checkLinkChange(ctx, req, group); msg != "" {
+		return msg
+	}
+
+	perm, err := findPermission(ctx, group)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if perm == nil {
+		return common.SendError(fmt.Sprintf("'%s' doesn't exist", group))
+	}
+
+	var rotates bool
+	store.view(func(st *state) {
+		_, rotates = st.Rotations[group]
+	})
+
+	if rotates {
+		return common.SendError(fmt.Sprintf("'%s' rotates, its membership can't follow role-srv as well", group))
+	}
+
+	if groupInfoOf(group).Joinable {
+		return common.SendError(fmt.Sprintf("'%s' is joinable, its membership can't follow role-srv as well", group))
+	}
+
+	if err := checkLinkable(group); err != nil {
+		return common.SendError(err.Error())
+	}
+
+	l := link{Group: group, Source: source}
+	if _, err = l.members(ctx); err != nil {
+		return common.SendError(fmt.Sprintf("Unable to read %s from role-srv: %s", source, err))
+	}
+
+	if isDryRun(ctx) {
+		return common.SendSuccess(fmt.Sprintf("'%s' would follow %s\n", group, source))
+	}
+
+	err = store.update(func(st *state) {
+		st.Links[group] = l
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	changes, err := syncLink(ctx, req, l)
+	if err != nil {
+		return common.SendFatal(fmt.Sprintf("Linked '%s' to %s but the first sync failed: %s", group, source, err))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("'%s' now follows %s, %d members added and %d removed\n",
+		group, source, count(changes, "add"), count(changes, "remove")))
+}
+
+func unlinkGroup(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 {
+		return common.SendError("Usage: !perms unlink <group>")
+	}
+
+	group := req.Args[2]
+	if msg := checkLinkChange(ctx, req, group); msg != "" {
+		return msg
+	}
+
+	var exists bool
+	err := store.update(func(st *state) {
+		if _, exists = st.Links[group]; exists {
+			delete(st.Links, group)
+		}
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if !exists {
+		return common.SendError(fmt.Sprintf("'%s' isn't linked", group))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("'%s' no longer follows role-srv, its members are left as they are\n", group))
+}
+
+// checkLinkChange makes sure the sender may hand a group's membership over to role-srv.
+func checkLinkChange(ctx context.Context, req *proto.ExecRequest, group string) string {
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if group == "perms_admins" {
+		if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+			return msg
+		}
+	}
+
+	return checkPermission(ctx, req.Sender, membershipPerms)
+}
+
+// checkLinkable refuses groups that reach anything admins guard, since nobody
+// vets who role-srv puts in them.
+func checkLinkable(group string) error {
+	for _, g := range reachableGroups(group) {
+		switch {
+		case g == "perms_admins" || g == "server_admins" || isProtected(g):
+			return fmt.Errorf("'%s' is protected, so membership of '%s' can't follow role-srv", g, group)
+		case contains(settings.readers(), g):
+			return fmt.Errorf("'%s' grants admin rights, so membership of '%s' can't follow role-srv", g, group)
+		}
+	}
+
+	return nil
+}
+
+func listLinks() string {
+	var links []link
+	store.view(func(st *state) {
+		for _, l := range st.Links {
+			links = append(links, l)
+		}
+	})
+
+	if len(links) == 0 {
+		return common.SendError("No linked groups")
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Group < links[j].Group })
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Linked Groups:\n")
+	for _, l := range links {
+		buffer.WriteString(fmt.Sprintf("\t%s: %s\n", l.Group, l.Source))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func count(changes []operation, action string) int {
+	var n int
+	for _, change := range changes {
+		if change.Action == action {
+			n++
+		}
+	}
+
+	return n
+}
+
+// syncLink adds and removes members of l's group until it matches role-srv.
+func syncLink(ctx context.Context, req *proto.ExecRequest, l link) ([]operation, error) {
+	// A closed window is holding the members back, they'll be synced when it opens
+	var w window
+	var ok bool
+	store.view(func(st *state) {
+		w, ok = st.Windows[l.Group]
+	})
+
+	if ok && w.Closed {
+		return nil, nil
+	}
+
+	wanted, err := l.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: l.Group})
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool)
+	for _, user := range users.UserList {
+		current[user] = true
+	}
+
+	var changes []operation
+	for _, user := range wanted {
+		if !current[user] {
+			changes = append(changes, operation{Action: "add", Group: l.Group, User: user})
+		}
+		delete(current, user)
+	}
+
+	// An empty filter is more likely a role-srv hiccup than everybody leaving at once
+	if len(wanted) > 0 {
+		for user := range current {
+			changes = append(changes, operation{Action: "remove", Group: l.Group, User: user, Channels: scopeOf(l.Group, user)})
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if _, err = applyChanges(ctx, req, changes, 0); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// runLinks brings every linked group in line with role-srv.
+func runLinks(ctx context.Context) {
+	var links []link
+	store.view(func(st *state) {
+		for _, l := range st.Links {
+			links = append(links, l)
+		}
+	})
+
+	for _, l := range links {
+		// Settings or includes may have changed since the group was linked
+		if err := checkLinkable(l.Group); err != nil {
+			logger.Warn("Not syncing linked group", zap.String("group", l.Group), zap.Error(err))
+			continue
+		}
+
+		req := &proto.ExecRequest{Sender: systemSender, Args: []string{cmdName, "link", l.Group, "sync"}}
+		changes, err := syncLink(ctx, req, l)
+		if err != nil {
+			logger.Error("Unable to sync linked group", zap.String("group", l.Group), zap.String("source", l.Source), zap.Error(err))
+			continue
+		}
+
+		if len(changes) > 0 {
+			logger.Info("Synced linked group", zap.String("group", l.Group), zap.String("source", l.Source),
+				zap.Int("added", count(changes, "add")), zap.Int("removed", count(changes, "remove")))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+)
+
+func offboardUser(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 || !common.IsDiscordUser(req.Args[2]) {
+		return common.SendError("Usage: !perms offboard <user>")
+	}
+
+	user := common.ExtractUserId(req.Args[2])
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+		return msg
+	}
+
+	permsClient := clientFactory.NewPermsClient()
+	permissions, err := permsClient.ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	// Memberships held back by a closed window go too, or it'd give them back
+	groups := permissions.PermissionsList
+	for _, group := range stashedGroups(user) {
+		if !holds(permissions.PermissionsList, group) {
+			groups = append(groups, &permsrv.Permission{Name: group, Description: "held back until its window opens"})
+		}
+	}
+
+	if len(groups) == 0 {
+		return common.SendError("User isn't in any permission groups")
+	}
+
+	var buffer bytes.Buffer
+	var protected bool
+	for _, perm := range groups {
+		if perm.Name == "perms_admins" {
+			if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+				return msg
+			}
+		}
+
+		if msg := checkSelfModification(ctx, req, user, perm.Name); msg != "" {
+			return msg
+		}
+
+		protected = protected || isProtected(perm.Name)
+		buffer.WriteString(fmt.Sprintf("\t%s: %s\n", perm.Name, perm.Description))
+	}
+
+	if settings.TwoPersonRule && !isConfirmed(ctx) && protected {
+		return requestApproval(ctx, req, "Offboarding a member of a protected group needs approval")
+	}
+
+	if !isConfirmed(ctx) {
+		return requestConfirmation(ctx, req, fmt.Sprintf("This will remove the user from %d groups:\n%s",
+			len(groups), buffer.String()))
+	}
+
+	var changes []operation
+	for _, perm := range groups {
+		changes = append(changes, operation{Action: "remove", Group: perm.Name, User: user, Channels: memberChannels(perm.Name, user)})
+	}
+
+	if _, err = applyChanges(ctx, req, changes, 0); err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Removed the user from %d groups\n", len(groups)))
+}
+
+// holds reports whether permissions includes the group called name.
+func holds(permissions []*permsrv.Permission, name string) bool {
+	for _, perm := range permissions {
+		if perm.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
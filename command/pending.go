@@ -0,0 +1,230 @@
+package command
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+	"time"
+)
+
+type contextKey int
+
+const (
+	confirmedKey contextKey = iota
+	dryRunKey
+	scheduledKey
+	approverKey
+	deniedKey
+)
+
+// pendingChange is a command that will be run again, as its original sender,
+// once somebody confirms it.
+type pendingChange struct {
+	Id      string    `json:"id"`
+	Sender  string    `json:"sender"`
+	Args    []string  `json:"args"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	// Approval is set when the change has to be confirmed by a different admin
+	Approval bool `json:"approval"`
+}
+
+// isConfirmed reports whether the command being run has already been
+// confirmed, or approved, either just now or when it was scheduled.
+func isConfirmed(ctx context.Context) bool {
+	confirmed, _ := ctx.Value(confirmedKey).(bool)
+	scheduled, _ := ctx.Value(scheduledKey).(bool)
+	return confirmed || scheduled
+}
+
+// approvedBy returns the admin who approved the command being run, if anybody did.
+func approvedBy(ctx context.Context) string {
+	approver, _ := ctx.Value(approverKey).(string)
+	return approver
+}
+
+// isDryRun reports whether the command being run should only say what it would do.
+func isDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey).(bool)
+	return dryRun
+}
+
+// requestApproval parks req until another admin confirms it.
+func requestApproval(ctx context.Context, req *proto.ExecRequest, reason string) string {
+	if isDryRun(ctx) {
+		return common.SendSuccess(fmt.Sprintf("%s, another admin would need to approve it\n", reason))
+	}
+
+	id, err := addPending(req, true, settings.approvalWindow())
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("%s, another admin needs to approve it within %s with `!perms confirm %s`\n",
+		reason, settings.approvalWindow(), id))
+}
+
+// requestConfirmation parks req until its sender confirms it, after they've
+// had a chance to read summary.
+func requestConfirmation(ctx context.Context, req *proto.ExecRequest, summary string) string {
+	if isDryRun(ctx) {
+		return fmt.Sprintf("```%s```%s", summary, common.SendSuccess("This would need confirming\n"))
+	}
+
+	id, err := addPending(req, false, settings.confirmWindow())
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return fmt.Sprintf("```%s```%s", summary,
+		common.SendError(fmt.Sprintf("Run `!perms confirm %s` within %s to go ahead\n", id, settings.confirmWindow())))
+}
+
+func addPending(req *proto.ExecRequest, approval bool, window time.Duration) (string, error) {
+	id, err := newId()
+	if err != nil {
+		return "", err
+	}
+
+	change := pendingChange{
+		Id:       id,
+		Sender:   req.Sender,
+		Args:     req.Args,
+		Created:  time.Now(),
+		Expires:  time.Now().Add(window),
+		Approval: approval,
+	}
+
+	err = store.update(func(st *state) {
+		expirePending(st)
+		st.Pending[change.Id] = change
+	})
+
+	return change.Id, err
+}
+
+// newId returns a short random id for people to refer to things by.
+func newId() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func confirmChange(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 {
+		return common.SendError("Usage: !perms confirm <id>")
+	}
+
+	var change pendingChange
+	var ok bool
+	err := store.update(func(st *state) {
+		expirePending(st)
+		change, ok = st.Pending[req.Args[2]]
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if !ok {
+		return common.SendError(fmt.Sprintf("No pending change with id '%s', it may have expired", req.Args[2]))
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if change.Approval {
+		if senderId(change.Sender) == senderId(req.Sender) {
+			return common.SendError("This change has to be approved by a different admin")
+		}
+
+		// The approver has to be allowed to make the change themselves, so try it as them
+		var denied bool
+		probe := context.WithValue(context.WithValue(ctx, dryRunKey, true), deniedKey, &denied)
+		if result := run(probe, &proto.ExecRequest{Sender: req.Sender, Args: change.Args}); denied {
+			return result
+		}
+	} else if change.Sender != req.Sender {
+		return common.SendError("Only the sender of this change may confirm it")
+	}
+
+	err = store.update(func(st *state) {
+		delete(st.Pending, change.Id)
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	ctx = context.WithValue(ctx, confirmedKey, true)
+	if change.Approval {
+		ctx = context.WithValue(ctx, approverKey, senderId(req.Sender))
+	}
+
+	return run(ctx, &proto.ExecRequest{Sender: change.Sender, Args: change.Args})
+}
+
+func listPending(ctx context.Context, req *proto.ExecRequest) string {
+	var buffer bytes.Buffer
+	var changes []pendingChange
+
+	err := store.update(func(st *state) {
+		expirePending(st)
+		for _, change := range st.Pending {
+			changes = append(changes, change)
+		}
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if len(changes) == 0 {
+		return common.SendError("No pending changes")
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Created.Before(changes[j].Created) })
+
+	buffer.WriteString("Pending Changes:\n")
+	for _, change := range changes {
+		buffer.WriteString(fmt.Sprintf("\t%s: !%s by %s, expires in %s\n",
+			change.Id, strings.Join(change.Args, " "), senderId(change.Sender), time.Until(change.Expires).Round(time.Second)))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// expirePending drops the changes nobody confirmed in time.
+func expirePending(st *state) {
+	for id, change := range st.Pending {
+		if time.Now().After(change.Expires) {
+			delete(st.Pending, id)
+		}
+	}
+}
+
+// checkSelfModification applies the self modification policy to the sender
+// changing user's membership of permission. Only another admin's approval
+// gets round it, confirming or scheduling the change doesn't.
+func checkSelfModification(ctx context.Context, req *proto.ExecRequest, user, permission string) string {
+	if approvedBy(ctx) != "" || user != senderId(req.Sender) || !isProtected(permission) {
+		return ""
+	}
+
+	switch settings.SelfModification {
+	case "deny":
+		return common.SendError("You may not change your own membership of protected groups")
+	case "approve":
+		return requestApproval(ctx, req, fmt.Sprintf("Changing your own membership of '%s' needs approval", permission))
+	}
+
+	return ""
+}
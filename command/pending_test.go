@@ -0,0 +1,108 @@
+package command
+
+import (
+	proto "github.com/chremoas/chremoas/proto"
+	"golang.org/x/net/context"
+	"strings"
+	"testing"
+)
+
+func TestCheckSelfModification(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		user      string
+		group     string
+		confirmed bool
+		approver  string
+		want      string
+		pending   int
+	}{
+		{name: "allowed", policy: "allow", user: "1", group: "perms_admins"},
+		{name: "denied", policy: "deny", user: "1", group: "perms_admins", want: "may not change your own"},
+		{name: "needs approval", policy: "approve", user: "1", group: "perms_admins", want: "needs approval", pending: 1},
+		{name: "somebody else", policy: "deny", user: "2", group: "perms_admins"},
+		{name: "unprotected group", policy: "deny", user: "1", group: "fc_tools"},
+		{name: "confirmed", policy: "approve", user: "1", group: "perms_admins", confirmed: true, want: "needs approval", pending: 1},
+		{name: "approved by another admin", policy: "deny", user: "1", group: "perms_admins", approver: "2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestState(t)
+			settings.SelfModification = test.policy
+
+			req := &proto.ExecRequest{Sender: "ops:1", Args: []string{"perms", "add", "<@" + test.user + ">", test.group}}
+			ctx := context.WithValue(context.Background(), confirmedKey, test.confirmed)
+			if test.approver != "" {
+				ctx = context.WithValue(ctx, approverKey, test.approver)
+			}
+
+			got := checkSelfModification(ctx, req, test.user, test.group)
+			if (test.want == "") != (got == "") || !strings.Contains(got, test.want) {
+				t.Errorf("checkSelfModification = %q, want %q", got, test.want)
+			}
+
+			var pending int
+			store.view(func(st *state) {
+				for _, change := range st.Pending {
+					if change.Approval {
+						pending++
+					}
+				}
+			})
+			if pending != test.pending {
+				t.Errorf("%d changes waiting for approval, want %d", pending, test.pending)
+			}
+		})
+	}
+}
+
+func TestConfirmTwoPersonRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		approval  bool
+		sender    string
+		confirmer string
+		want      string
+		added     bool
+	}{
+		{name: "approved by another admin", approval: true, sender: "ops:1", confirmer: "ops:2", want: "Added", added: true},
+		{name: "approved by the sender", approval: true, sender: "ops:1", confirmer: "ops:1", want: "approved by a different admin"},
+		{name: "confirmed by the sender", sender: "ops:1", confirmer: "ops:1", want: "Added", added: true},
+		{name: "confirmed by somebody else", sender: "ops:1", confirmer: "ops:2", want: "Only the sender"},
+		{name: "approved by somebody who can't make it", approval: true, sender: "ops:1", confirmer: "ops:4", want: "doesn't have permission"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestState(t)
+			settings.TwoPersonRule = true
+			settings.ProtectedGroups = append(settings.ProtectedGroups, "fc_leads")
+			perms := useFakePerms(t, map[string][]string{"perms_admins": {"1", "2"}, "fc_leads": {}})
+
+			id, err := addPending(&proto.ExecRequest{Sender: test.sender, Args: []string{"perms", "add", "<@3>", "fc_leads"}},
+				test.approval, settings.approvalWindow())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := confirmChange(context.Background(), &proto.ExecRequest{Sender: test.confirmer, Args: []string{"perms", "confirm", id}})
+			if !strings.Contains(got, test.want) {
+				t.Errorf("confirm = %q, want %q", got, test.want)
+			}
+
+			if added := perms.holds("3", "fc_leads"); added != test.added {
+				t.Errorf("added = %t, want %t", added, test.added)
+			}
+
+			var waiting bool
+			store.view(func(st *state) {
+				_, waiting = st.Pending[id]
+			})
+			if waiting == test.added {
+				t.Errorf("still pending = %t after confirm = %q", waiting, got)
+			}
+		})
+	}
+}
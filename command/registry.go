@@ -0,0 +1,302 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+// metadataPrefix starts the registry metadata keys command services use to
+// declare what their subcommands need, e.g. perms.set: role_admins,sig_admins.
+// A bare perms key covers every subcommand.
+const metadataPrefix = "perms"
+
+// requirement is what running a command needs and where we learnt it.
+type requirement struct {
+	// Groups are the checks the command makes, somebody needs one group from each
+	Groups [][]string
+
+	// Source is config, registry or builtin, or empty when nothing is known
+	Source string
+
+	// Note qualifies a builtin requirement that doesn't always apply
+	Note string
+}
+
+// ownNeed is what one of perms-cmd's subcommands asks for, as the kinds of
+// admin each of its checks accepts.
+type ownNeed struct {
+	checks [][]string
+	note   string
+}
+
+// ownNeeds are perms-cmd's own subcommands that need a group to run. They're
+// the checks every use makes, Note covers the ones only some uses make.
+var ownNeeds = map[string]ownNeed{
+	"create":     {checks: [][]string{{"create"}}},
+	"destroy":    {checks: [][]string{{"destroy"}}},
+	"restore":    {checks: [][]string{{"create"}, {"membership"}}, note: "membership only when the group had members"},
+	"add":        {checks: [][]string{{"membership"}}, note: "server_admins as well for perms_admins"},
+	"remove":     {checks: [][]string{{"membership"}}, note: "server_admins as well for perms_admins"},
+	"offboard":   {checks: [][]string{{"membership"}}, note: "server_admins as well for perms_admins members"},
+	"migrate":    {checks: [][]string{{"membership"}}},
+	"rotation":   {checks: [][]string{{"membership"}}, note: "except list and who"},
+	"window":     {checks: [][]string{{"membership"}}, note: "server_admins as well for perms_admins"},
+	"link":       {checks: [][]string{{"membership"}}, note: "server_admins as well for protected groups"},
+	"unlink":     {checks: [][]string{{"membership"}}, note: "server_admins as well for protected groups"},
+	"include":    {checks: [][]string{{"create"}, {"membership"}}, note: "server_admins as well for protected groups"},
+	"exclude":    {checks: [][]string{{"create"}, {"membership"}}, note: "server_admins as well for protected groups"},
+	"joinable":   {checks: [][]string{{"create"}}, note: "except listing joinable groups"},
+	"lifecycle":  {checks: [][]string{{"create", "destroy"}}, note: "destroy to archive, create otherwise"},
+	"schedule":   {checks: [][]string{{"destroy", "membership"}}, note: "whichever the scheduled change needs"},
+	"scheduled":  {checks: [][]string{{"destroy", "membership"}}, note: "only to cancel somebody else's change"},
+	"diff":       {checks: [][]string{{"membership"}}, note: "only with --copy"},
+	"batch":      {checks: [][]string{{"create", "destroy", "membership"}}, note: "whatever each change needs"},
+	"revert":     {checks: [][]string{{"create", "destroy", "membership"}}, note: "whatever undoing each change needs"},
+	"undo":       {checks: [][]string{{"create", "destroy", "membership"}}, note: "whatever undoing each change needs"},
+	"confirm":    {checks: [][]string{{"create", "destroy", "membership"}}, note: "whatever the pending change needs"},
+	"as":         {checks: [][]string{{"server"}}},
+	"audit":      {checks: [][]string{{"readers"}}},
+	"export":     {checks: [][]string{{"readers"}}},
+	"whois":      {checks: [][]string{{"readers"}}},
+	"impact":     {checks: [][]string{{"readers"}}},
+	"notices":    {checks: [][]string{{"readers"}}},
+	"check":      {checks: [][]string{{"readers"}}, note: "only to check somebody else"},
+	"list_users": {checks: [][]string{{"readers"}}, note: "only for protected groups"},
+	"who_can":    {checks: [][]string{{"readers"}}, note: "only with --users"},
+}
+
+// adminKind returns the groups that make somebody the given kind of admin.
+func adminKind(kind string) []string {
+	switch kind {
+	case "create":
+		return settings.Create
+	case "destroy":
+		return settings.Destroy
+	case "membership":
+		return settings.Membership
+	case "server":
+		return []string{"server_admins"}
+	case "readers":
+		return settings.readers()
+	}
+
+	return nil
+}
+
+// ownRequirement is what perms-cmd itself asks for to run subcommand.
+func ownRequirement(subcommand string) requirement {
+	need, ok := ownNeeds[subcommand]
+	if !ok {
+		return requirement{Source: "builtin"}
+	}
+
+	var groups [][]string
+	for _, kinds := range need.checks {
+		var check []string
+		for _, kind := range kinds {
+			for _, group := range adminKind(kind) {
+				if !contains(check, group) {
+					check = append(check, group)
+				}
+			}
+		}
+		groups = append(groups, check)
+	}
+
+	return requirement{Groups: groups, Source: "builtin", Note: need.note}
+}
+
+// oneOf is the requirement for a single check accepting any of groups.
+func oneOf(groups []string) [][]string {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	return [][]string{groups}
+}
+
+// requiredGroups looks up the groups allowed to run command subcommand,
+// preferring the configuration over what the service registered itself.
+func requiredGroups(command, subcommand string) (requirement, error) {
+	for _, key := range []string{command + " " + subcommand, command} {
+		if groups, ok := settings.Commands[key]; ok {
+			return requirement{Groups: oneOf(groups), Source: "config"}, nil
+		}
+	}
+
+	if command == cmdName {
+		return ownRequirement(subcommand), nil
+	}
+
+	metadata, err := clientFactory.CommandMetadata(command)
+	if err != nil {
+		return requirement{}, err
+	}
+
+	for _, key := range []string{metadataPrefix + "." + subcommand, metadataPrefix} {
+		if value, ok := metadata[key]; ok {
+			var groups []string
+			for _, group := range strings.Split(value, ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					groups = append(groups, group)
+				}
+			}
+			return requirement{Groups: oneOf(groups), Source: "registry"}, nil
+		}
+	}
+
+	return requirement{}, nil
+}
+
+// grantingGroups returns every group whose members hold one of groups,
+// directly or through includes.
+func grantingGroups(groups []string) []string {
+	var candidates []string
+	store.view(func(st *state) {
+		for group, info := range st.Groups {
+			if len(info.Includes) > 0 {
+				candidates = append(candidates, group)
+			}
+		}
+	})
+
+	granting := make(map[string]bool)
+	for _, group := range groups {
+		granting[group] = true
+	}
+
+	for _, candidate := range candidates {
+		reached := expandGroups([]string{candidate}, func(string) bool { return true })
+		for _, group := range groups {
+			if _, ok := reached[group]; ok {
+				granting[candidate] = true
+			}
+		}
+	}
+
+	var result []string
+	for group := range granting {
+		result = append(result, group)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func whoCan(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 4 && (len(req.Args) != 5 || req.Args[4] != "--users") {
+		return common.SendError("Usage: !perms who_can <command> <subcommand> [--users]")
+	}
+
+	command, subcommand := strings.TrimPrefix(req.Args[2], "!"), req.Args[3]
+	listUsers := len(req.Args) == 5
+
+	if listUsers {
+		if msg := checkChannel(req.Sender); msg != "" {
+			return msg
+		}
+
+		if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+			return msg
+		}
+	}
+
+	need, err := requiredGroups(command, subcommand)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if need.Source == "" {
+		return common.SendError(fmt.Sprintf("Nothing says what `!%s %s` needs, add it to extensions.perms.commands or the service's registry metadata",
+			command, subcommand))
+	}
+
+	if len(need.Groups) == 0 {
+		return common.SendSuccess(fmt.Sprintf("Anybody can run `!%s %s` (%s)\n", command, subcommand, need.Source))
+	}
+
+	var buffer bytes.Buffer
+	var granting [][]string
+	for i, check := range need.Groups {
+		if i == 0 {
+			buffer.WriteString(fmt.Sprintf("!%s %s needs one of (%s):\n", command, subcommand, need.Source))
+		} else {
+			buffer.WriteString("And one of:\n")
+		}
+		for _, group := range check {
+			buffer.WriteString(fmt.Sprintf("\t%s\n", group))
+		}
+
+		g := grantingGroups(check)
+		if len(g) > len(check) {
+			buffer.WriteString("Or a group including one of them:\n")
+			for _, group := range g {
+				if !contains(check, group) {
+					buffer.WriteString(fmt.Sprintf("\t%s\n", group))
+				}
+			}
+		}
+		granting = append(granting, g)
+	}
+
+	if need.Note != "" {
+		buffer.WriteString(fmt.Sprintf("Note: %s\n", need.Note))
+	}
+
+	if !listUsers {
+		return fmt.Sprintf("```%s```", buffer.String())
+	}
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	// Somebody has to get through every check
+	var users map[string]bool
+	for _, check := range granting {
+		passing := make(map[string]bool)
+		for _, group := range check {
+			members, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: group})
+			if err != nil {
+				return common.SendFatal(err.Error())
+			}
+
+			for _, user := range members.UserList {
+				if users == nil || users[user] {
+					passing[user] = true
+				}
+			}
+		}
+		users = passing
+	}
+
+	var list []string
+	for user := range users {
+		list = append(list, userName(names, user))
+	}
+	sort.Strings(list)
+
+	buffer.WriteString(fmt.Sprintf("Users (%d):\n", len(list)))
+	for _, name := range list {
+		buffer.WriteString(fmt.Sprintf("\t%s\n", name))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
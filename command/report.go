@@ -0,0 +1,223 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	rolesrv "github.com/chremoas/role-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+func exportPermissions(ctx context.Context, req *proto.ExecRequest) string {
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+		return msg
+	}
+
+	var buffer bytes.Buffer
+	permsClient := clientFactory.NewPermsClient()
+	permissions, err := permsClient.ListPermissions(ctx, &permsrv.NilRequest{})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	buffer.WriteString("Permission Groups:\n")
+	for _, perm := range permissions.PermissionsList {
+		users, err := permsClient.ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: perm.Name})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		buffer.WriteString(fmt.Sprintf("\t%s: %s (%d members)\n", perm.Name, perm.Description, len(users.UserList)))
+		for _, user := range users.UserList {
+			buffer.WriteString(fmt.Sprintf("\t\t%s\n", userName(names, user)))
+		}
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// whois brings together what perms-srv and role-srv know about a user, for access reviews.
+func whois(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 || !common.IsDiscordUser(req.Args[2]) {
+		return common.SendError("Usage: !perms whois <user>")
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, auditorPerms); msg != "" {
+		return msg
+	}
+
+	user := common.ExtractUserId(req.Args[2])
+	roleClient := clientFactory.NewRolesClient()
+	permsClient := clientFactory.NewPermsClient()
+
+	u, err := roleClient.GetDiscordUser(ctx, &rolesrv.GetDiscordUserRequest{UserId: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	permissions, err := permsClient.ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	roles, err := roleClient.ListUserRoles(ctx, &rolesrv.ListUserRolesRequest{UserId: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("User: %s#%s (%s)\n", u.Username, u.Discriminator, u.Id))
+	if len(u.Nick) != 0 {
+		buffer.WriteString(fmt.Sprintf("\tNick: %s\n", u.Nick))
+	}
+	buffer.WriteString(fmt.Sprintf("\tBot: %s\n", yesNo(u.Bot)))
+	buffer.WriteString(fmt.Sprintf("\tMFA: %s\n", yesNo(u.MfaEnabled)))
+
+	var direct []string
+	buffer.WriteString("Permission Groups:\n")
+	for _, perm := range permissions.PermissionsList {
+		direct = append(direct, perm.Name)
+		buffer.WriteString(fmt.Sprintf("\t%s: %s%s", perm.Name, perm.Description, expiryNote(perm.Name)))
+		if channels := scopeOf(perm.Name, user); len(channels) > 0 {
+			buffer.WriteString(fmt.Sprintf(" (only in %s)", channelMentions(channels)))
+		}
+		buffer.WriteString("\n")
+	}
+
+	groups := expandGroups(direct, func(string) bool { return true })
+	for _, group := range sortedKeys(groups) {
+		if groups[group] != "" {
+			buffer.WriteString(fmt.Sprintf("\t%s (%s)\n", group, strings.TrimSpace(inheritanceChain(groups, group))))
+		}
+	}
+
+	var sigs bytes.Buffer
+	buffer.WriteString("Roles:\n")
+	for _, role := range roles.Roles {
+		if role.Sig {
+			sigs.WriteString(fmt.Sprintf("\t%s: %s\n", role.ShortName, role.Name))
+		} else {
+			buffer.WriteString(fmt.Sprintf("\t%s: %s\n", role.ShortName, role.Name))
+		}
+	}
+
+	buffer.WriteString("SIGs:\n")
+	buffer.Write(sigs.Bytes())
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// listMine shows the sender the groups they hold, without needing a mention or any admin rights.
+func listMine(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 2 {
+		return common.SendError("Usage: !perms mine")
+	}
+
+	user := senderId(req.Sender)
+	permsClient := clientFactory.NewPermsClient()
+	permissions, err := permsClient.ListPermissions(ctx, &permsrv.NilRequest{})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	mine, err := permsClient.ListUserPermissions(ctx, &permsrv.PermissionUser{User: user})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if len(mine.PermissionsList) == 0 {
+		return common.SendError("You aren't in any permission groups")
+	}
+
+	var direct []string
+	for _, perm := range mine.PermissionsList {
+		direct = append(direct, perm.Name)
+	}
+	groups := expandGroups(direct, func(string) bool { return true })
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Your Permission Groups:\n")
+	for _, perm := range permissions.PermissionsList {
+		via, ok := groups[perm.Name]
+		if !ok {
+			continue
+		}
+
+		buffer.WriteString(fmt.Sprintf("\t%s: %s%s%s", perm.Name, perm.Description, expiryNote(perm.Name), lifecycleNote(perm.Name)))
+		if via != "" {
+			buffer.WriteString(fmt.Sprintf(" (%s)", strings.TrimSpace(inheritanceChain(groups, perm.Name))))
+		}
+		if channels := scopeOf(perm.Name, user); len(channels) > 0 {
+			buffer.WriteString(fmt.Sprintf(" (only in %s)", channelMentions(channels)))
+		}
+		if !windowOpen(perm.Name) {
+			buffer.WriteString(" (inactive right now, see `!perms window " + perm.Name + "`)")
+		}
+		buffer.WriteString("\n")
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// userNames maps discord user ids to the name we'd show for them in a listing.
+func userNames(ctx context.Context) (map[string]string, error) {
+	names := make(map[string]string)
+
+	users, err := clientFactory.NewRolesClient().GetDiscordUserList(ctx, &rolesrv.NilMessage{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users.Users {
+		if len(u.Nick) != 0 {
+			names[u.Id] = u.Nick
+		} else {
+			names[u.Id] = u.Username
+		}
+	}
+
+	return names, nil
+}
+
+func userName(names map[string]string, user string) string {
+	if name, ok := names[user]; ok {
+		return name
+	}
+
+	return user
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"golang.org/x/net/context"
+)
+
+// destroyOperation describes destroying name along with its members, keeping
+// what's needed to restore it.
+func destroyOperation(ctx context.Context, name string, members []string) (operation, error) {
+	change := operation{Action: "destroy", Group: name, Members: members}
+
+	perm, err := findPermission(ctx, name)
+	if err != nil {
+		return change, err
+	}
+
+	if perm != nil {
+		change.Description = perm.Description
+	}
+
+	store.view(func(st *state) {
+		change.Scopes = st.Scopes[name]
+		if w, ok := st.Windows[name]; ok {
+			change.Window = &w
+		}
+		if r, ok := st.Rotations[name]; ok {
+			change.Rotation = &r
+		}
+		if l, ok := st.Links[name]; ok {
+			change.Link = &l
+		}
+		if info, ok := st.Groups[name]; ok {
+			change.Info = &info
+		}
+	})
+
+	change.IncludedBy = includedBy(name)
+
+	return change, nil
+}
+
+// findPermission returns the permission group called name, or nil if there isn't one.
+func findPermission(ctx context.Context, name string) (*permsrv.Permission, error) {
+	permissions, err := clientFactory.NewPermsClient().ListPermissions(ctx, &permsrv.NilRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, perm := range permissions.PermissionsList {
+		if perm.Name == name {
+			return perm, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func restorePermission(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) != 3 {
+		return common.SendError("Usage: !perms restore <permission_group>")
+	}
+
+	name := req.Args[2]
+
+	var destroyed operation
+	var ok bool
+	store.view(func(st *state) {
+		destroyed, ok = st.Destroyed[name]
+	})
+
+	if !ok {
+		return common.SendError(fmt.Sprintf("No record of '%s' being destroyed", name))
+	}
+
+	changes := []operation{destroyed.inverse()}
+	if msg := authorizeChanges(ctx, req, changes); msg != "" {
+		return msg
+	}
+
+	if _, err := applyChanges(ctx, req, changes, 0); err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Restored '%s' with %d members\n", name, len(destroyed.Members)))
+}
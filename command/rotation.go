@@ -0,0 +1,363 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"sort"
+	"time"
+)
+
+const rotationUsage = "Usage: !perms rotation <create <group> <period> [--from <when>]|delete <group>|roster <add|remove> <group> <user>|who <group>|list>"
+
+// rotation hands membership of Group to the next user on the Roster every Period.
+type rotation struct {
+	Group    string        `json:"group"`
+	Period   time.Duration `json:"period"`
+	Roster   []string      `json:"roster"`
+	OnDuty   string        `json:"onDuty,omitempty"`
+	Next     int           `json:"next"`
+	Handover time.Time     `json:"handover"`
+}
+
+// upNext returns who takes over at the next handover.
+func (r rotation) upNext() string {
+	if len(r.Roster) == 0 {
+		return ""
+	}
+
+	return r.Roster[r.Next%len(r.Roster)]
+}
+
+func rotations(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 3 {
+		return common.SendError(rotationUsage)
+	}
+
+	switch req.Args[2] {
+	case "list":
+		return listRotations()
+	case "who":
+		if len(req.Args) != 4 {
+			return common.SendError(rotationUsage)
+		}
+		return rotationWho(ctx, req.Args[3])
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+		return msg
+	}
+
+	switch {
+	case req.Args[2] == "create" && (len(req.Args) == 5 || (len(req.Args) == 7 && req.Args[5] == "--from")):
+		return createRotation(ctx, req)
+	case req.Args[2] == "delete" && len(req.Args) == 4:
+		return deleteRotation(req.Args[3])
+	case req.Args[2] == "roster" && len(req.Args) == 6 && common.IsDiscordUser(req.Args[5]):
+		return changeRoster(ctx, req, req.Args[3], req.Args[4], common.ExtractUserId(req.Args[5]))
+	}
+
+	return common.SendError(rotationUsage)
+}
+
+func parsePeriod(period string) (time.Duration, error) {
+	switch period {
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d < time.Hour {
+		return 0, fmt.Errorf("Periods are daily, weekly or a duration of at least 1h like 12h")
+	}
+
+	return d, nil
+}
+
+func createRotation(ctx context.Context, req *proto.ExecRequest) string {
+	group := req.Args[3]
+
+	perm, err := findPermission(ctx, group)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if perm == nil {
+		return common.SendError(fmt.Sprintf("'%s' doesn't exist", group))
+	}
+
+	var linked bool
+	store.view(func(st *state) {
+		_, linked = st.Links[group]
+	})
+
+	if linked {
+		return common.SendError(fmt.Sprintf("'%s' follows role-srv, it can't rotate as well", group))
+	}
+
+	if groupInfoOf(group).Joinable {
+		return common.SendError(fmt.Sprintf("'%s' is joinable, it can't rotate as well", group))
+	}
+
+	if msg := checkRotation(ctx, req, group); msg != "" {
+		return msg
+	}
+
+	period, err := parsePeriod(req.Args[4])
+	if err != nil {
+		return common.SendError(err.Error())
+	}
+
+	handover := time.Now()
+	if len(req.Args) == 7 {
+		if handover, err = parseWhen(req.Args[6], time.Now()); err != nil {
+			return common.SendError(err.Error())
+		}
+	}
+
+	var exists bool
+	err = store.update(func(st *state) {
+		if _, exists = st.Rotations[group]; !exists {
+			st.Rotations[group] = rotation{Group: group, Period: period, Handover: handover}
+		}
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if exists {
+		return common.SendError(fmt.Sprintf("'%s' already rotates", group))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("'%s' will rotate every %s, add people with `!perms rotation roster add %s <user>`\n",
+		group, period, group))
+}
+
+func deleteRotation(group string) string {
+	var exists bool
+	err := store.update(func(st *state) {
+		if _, exists = st.Rotations[group]; exists {
+			delete(st.Rotations, group)
+		}
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if !exists {
+		return common.SendError(fmt.Sprintf("'%s' doesn't rotate", group))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("'%s' no longer rotates, its members are left as they are\n", group))
+}
+
+// checkRotation applies the checks for adding somebody to group to setting up
+// its rotation. Handovers run unattended, so groups that need approval can't rotate.
+func checkRotation(ctx context.Context, req *proto.ExecRequest, group string) string {
+	reachable := reachableGroups(group)
+	for _, g := range reachable {
+		if isProtected(g) {
+			return common.SendError(fmt.Sprintf("Members of '%s' hold '%s', changes to it need approval so it can't rotate", group, g))
+		}
+	}
+
+	if contains(reachable, "perms_admins") {
+		if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+func changeRoster(ctx context.Context, req *proto.ExecRequest, action, group, user string) string {
+	if action == "add" {
+		if msg := checkRotation(ctx, req, group); msg != "" {
+			return msg
+		}
+
+		for _, g := range reachableGroups(group) {
+			if msg := checkSelfModification(ctx, req, user, g); msg != "" {
+				return msg
+			}
+		}
+	}
+
+	var exists, changed bool
+	err := store.update(func(st *state) {
+		var r rotation
+		if r, exists = st.Rotations[group]; !exists {
+			return
+		}
+
+		for i, u := range r.Roster {
+			if u != user {
+				continue
+			}
+
+			if action == "remove" {
+				r.Roster = append(r.Roster[:i:i], r.Roster[i+1:]...)
+				if r.Next > i {
+					r.Next--
+				}
+				changed = true
+			}
+			st.Rotations[group] = r
+			return
+		}
+
+		if action == "add" {
+			r.Roster = append(r.Roster, user)
+			changed = true
+		}
+		st.Rotations[group] = r
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	switch {
+	case !exists:
+		return common.SendError(fmt.Sprintf("'%s' doesn't rotate", group))
+	case action != "add" && action != "remove":
+		return common.SendError(rotationUsage)
+	case !changed && action == "add":
+		return common.SendError("User is already on the roster")
+	case !changed:
+		return common.SendError("User isn't on the roster")
+	case action == "add":
+		return common.SendSuccess(fmt.Sprintf("Added the user to the '%s' roster\n", group))
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Removed the user from the '%s' roster\n", group))
+}
+
+func rotationWho(ctx context.Context, group string) string {
+	var r rotation
+	var exists bool
+	store.view(func(st *state) {
+		r, exists = st.Rotations[group]
+	})
+
+	if !exists {
+		return common.SendError(fmt.Sprintf("'%s' doesn't rotate", group))
+	}
+
+	names, err := userNames(ctx)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%s rotates every %s:\n", group, r.Period))
+	if r.OnDuty != "" {
+		buffer.WriteString(fmt.Sprintf("\tOn now: %s\n", userName(names, r.OnDuty)))
+	} else {
+		buffer.WriteString("\tOn now: nobody\n")
+	}
+
+	if next := r.upNext(); next != "" {
+		buffer.WriteString(fmt.Sprintf("\tNext: %s at %s\n", userName(names, next), r.Handover.UTC().Format("2006-01-02 15:04")))
+	}
+
+	buffer.WriteString("Roster:\n")
+	for _, user := range r.Roster {
+		buffer.WriteString(fmt.Sprintf("\t%s\n", userName(names, user)))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func listRotations() string {
+	var list []rotation
+	store.view(func(st *state) {
+		for _, r := range st.Rotations {
+			list = append(list, r)
+		}
+	})
+
+	if len(list) == 0 {
+		return common.SendError("No rotations")
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Group < list[j].Group })
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Rotations:\n")
+	for _, r := range list {
+		buffer.WriteString(fmt.Sprintf("\t%s: every %s, %d on the roster, next handover %s\n",
+			r.Group, r.Period, len(r.Roster), r.Handover.UTC().Format("2006-01-02 15:04")))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+// runRotations hands over every rotation that's due.
+func runRotations(ctx context.Context) {
+	var due []rotation
+	store.view(func(st *state) {
+		for _, r := range st.Rotations {
+			if len(r.Roster) > 0 && !r.Handover.After(time.Now()) {
+				due = append(due, r)
+			}
+		}
+	})
+
+handover:
+	for _, r := range due {
+		// Settings may have changed since the rotation was set up
+		for _, g := range reachableGroups(r.Group) {
+			if isProtected(g) {
+				logger.Warn("Not handing over rotation of a protected group", zap.String("group", r.Group), zap.String("protected", g))
+				continue handover
+			}
+		}
+
+		next := r.upNext()
+
+		var changes []operation
+		if r.OnDuty != "" && r.OnDuty != next {
+			changes = append(changes, operation{Action: "remove", Group: r.Group, User: r.OnDuty})
+		}
+		if r.OnDuty != next {
+			changes = append(changes, operation{Action: "add", Group: r.Group, User: next})
+		}
+
+		// The same person can stay on, say on a roster of one, which isn't worth an audit entry
+		if len(changes) > 0 {
+			req := &proto.ExecRequest{Sender: systemSender, Args: []string{cmdName, "rotation", "handover", r.Group}}
+			if _, err := applyChanges(ctx, req, changes, 0); err != nil {
+				logger.Error("Unable to hand over rotation", zap.String("group", r.Group), zap.Error(err))
+				continue
+			}
+		}
+
+		err := store.update(func(st *state) {
+			current, ok := st.Rotations[r.Group]
+			if !ok {
+				return
+			}
+
+			current.OnDuty = next
+			if len(current.Roster) > 0 {
+				current.Next = (r.Next + 1) % len(current.Roster)
+			}
+			for !current.Handover.After(time.Now()) {
+				current.Handover = current.Handover.Add(current.Period)
+			}
+			st.Rotations[r.Group] = current
+		})
+		if err != nil {
+			logger.Error("Unable to update rotation", zap.String("group", r.Group), zap.Error(err))
+		}
+	}
+}
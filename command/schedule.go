@@ -0,0 +1,259 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scheduledChange is a command that will be run as its original sender at When.
+type scheduledChange struct {
+	Id      string    `json:"id"`
+	Sender  string    `json:"sender"`
+	Args    []string  `json:"args"`
+	When    time.Time `json:"when"`
+	Created time.Time `json:"created"`
+
+	// ApprovedBy is the admin who approved scheduling the change, if it needed approval
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+func scheduleChange(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 5 {
+		return common.SendError("Usage: !perms schedule <when> <add|remove|destroy> <arguments>")
+	}
+
+	when, err := parseWhen(req.Args[2], time.Now())
+	if err != nil {
+		return common.SendError(err.Error())
+	}
+
+	subcommand := req.Args[3]
+	if subcommand != "add" && subcommand != "remove" && subcommand != "destroy" {
+		return common.SendError("Only add, remove and destroy can be scheduled")
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	if msg := checkPermission(ctx, req.Sender, capability(subcommand)); msg != "" {
+		return msg
+	}
+
+	var group string
+	switch {
+	case subcommand == "destroy":
+		group = req.Args[4]
+	case subcommand == "add" && len(req.Args) > 5:
+		group = req.Args[5]
+	default:
+		group = req.Args[len(req.Args)-1]
+	}
+
+	if subcommand != "destroy" {
+		users := req.Args[4:5]
+		if subcommand == "remove" {
+			users = req.Args[4 : len(req.Args)-1]
+		}
+
+		for _, user := range users {
+			if !common.IsDiscordUser(user) {
+				return common.SendError("Usage: !perms schedule <when> <add|remove|destroy> <arguments>")
+			}
+
+			if msg := checkSelfModification(ctx, req, common.ExtractUserId(user), group); msg != "" {
+				return msg
+			}
+		}
+	}
+
+	if settings.TwoPersonRule && !isConfirmed(ctx) && (subcommand == "destroy" || isProtected(group)) {
+		return requestApproval(ctx, req, "Scheduling this change needs approval")
+	}
+
+	// The sender won't be around to confirm it when it runs, so do that now
+	destructive := subcommand == "destroy" || (subcommand == "remove" && len(req.Args) > 6)
+	if destructive && !isConfirmed(ctx) {
+		return requestConfirmation(ctx, req, fmt.Sprintf("!%s will run at %s",
+			strings.Join(req.Args[3:], " "), when.UTC().Format(time.RFC1123)))
+	}
+
+	if isDryRun(ctx) {
+		return common.SendSuccess(fmt.Sprintf("!%s would be scheduled for %s\n", strings.Join(req.Args[3:], " "), when.UTC().Format(time.RFC1123)))
+	}
+
+	id, err := newId()
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	change := scheduledChange{
+		Id:         id,
+		Sender:     req.Sender,
+		Args:       append([]string{req.Args[0]}, req.Args[3:]...),
+		When:       when,
+		Created:    time.Now(),
+		ApprovedBy: approvedBy(ctx),
+	}
+
+	err = store.update(func(st *state) {
+		st.Scheduled[id] = change
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Scheduled %s for %s (in %s)\n",
+		id, when.UTC().Format(time.RFC1123), time.Until(when).Round(time.Minute)))
+}
+
+// parseWhen understands "downtime" (the next 11:00 UTC), durations from now
+// like 90m or 2h, and UTC times like 2006-01-02T15:04 or 2006-01-02.
+func parseWhen(when string, now time.Time) (time.Time, error) {
+	now = now.UTC()
+
+	if when == "downtime" {
+		downtime := time.Date(now.Year(), now.Month(), now.Day(), 11, 0, 0, 0, time.UTC)
+		if !downtime.After(now) {
+			downtime = downtime.AddDate(0, 0, 1)
+		}
+		return downtime, nil
+	}
+
+	if d, err := time.ParseDuration(when); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, when, time.UTC); err == nil {
+			if !t.After(now) {
+				return t, fmt.Errorf("%s is in the past", when)
+			}
+			return t, nil
+		}
+	}
+
+	return now, fmt.Errorf("Don't know when '%s' is, try downtime, 2h or 2006-01-02T15:04 (UTC)", when)
+}
+
+func scheduledChanges(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) == 3 && req.Args[2] == "list" {
+		return listScheduled()
+	}
+
+	if len(req.Args) == 4 && req.Args[2] == "cancel" {
+		return cancelScheduled(ctx, req, req.Args[3])
+	}
+
+	return common.SendError("Usage: !perms scheduled <list|cancel <id>>")
+}
+
+func listScheduled() string {
+	var changes []scheduledChange
+	store.view(func(st *state) {
+		for _, change := range st.Scheduled {
+			changes = append(changes, change)
+		}
+	})
+
+	if len(changes) == 0 {
+		return common.SendError("No scheduled changes")
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].When.Before(changes[j].When) })
+
+	var buffer bytes.Buffer
+	buffer.WriteString("Scheduled Changes:\n")
+	for _, change := range changes {
+		buffer.WriteString(fmt.Sprintf("\t%s: %s: !%s by %s\n",
+			change.Id, change.When.UTC().Format("2006-01-02 15:04"), strings.Join(change.Args, " "), senderId(change.Sender)))
+	}
+
+	return fmt.Sprintf("```%s```", buffer.String())
+}
+
+func cancelScheduled(ctx context.Context, req *proto.ExecRequest, id string) string {
+	var change scheduledChange
+	var ok bool
+	store.view(func(st *state) {
+		change, ok = st.Scheduled[id]
+	})
+
+	if !ok {
+		return common.SendError(fmt.Sprintf("No scheduled change with id '%s'", id))
+	}
+
+	if senderId(change.Sender) != senderId(req.Sender) {
+		if msg := checkPermission(ctx, req.Sender, capability(change.Args[1])); msg != "" {
+			return msg
+		}
+	}
+
+	err := store.update(func(st *state) {
+		delete(st.Scheduled, id)
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("Cancelled %s\n", id))
+}
+
+// runScheduled runs the scheduled changes that are due. Each one goes through
+// the same checks as when its sender typed it.
+func runScheduled(ctx context.Context) {
+	now := time.Now()
+
+	// This runs every minute, so only rewrite the state file when something's due
+	var due []scheduledChange
+	store.view(func(st *state) {
+		for _, change := range st.Scheduled {
+			if !change.When.After(now) {
+				due = append(due, change)
+			}
+		}
+	})
+
+	if len(due) == 0 {
+		return
+	}
+
+	// Anything cancelled in the meantime stays cancelled
+	var taken []scheduledChange
+	err := store.update(func(st *state) {
+		for _, change := range due {
+			if _, ok := st.Scheduled[change.Id]; ok {
+				taken = append(taken, change)
+				delete(st.Scheduled, change.Id)
+			}
+		}
+	})
+	if err != nil {
+		logger.Error("Unable to update scheduled changes", zap.Error(err))
+		return
+	}
+
+	sort.Slice(taken, func(i, j int) bool { return taken[i].When.Before(taken[j].When) })
+
+	for _, change := range taken {
+		// Approval and confirmation happened when it was scheduled, the rest is checked again now
+		scheduled := context.WithValue(ctx, scheduledKey, true)
+		if change.ApprovedBy != "" {
+			scheduled = context.WithValue(scheduled, approverKey, change.ApprovedBy)
+		}
+
+		result := run(scheduled, &proto.ExecRequest{Sender: change.Sender, Args: change.Args})
+		logger.Info("Ran scheduled change",
+			zap.String("id", change.Id),
+			zap.String("sender", change.Sender),
+			zap.Strings("args", change.Args),
+			zap.String("result", result))
+	}
+}
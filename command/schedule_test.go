@@ -0,0 +1,56 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	// A Friday morning
+	now := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		when    string
+		now     time.Time
+		want    time.Time
+		wantErr string
+	}{
+		{name: "downtime later today", when: "downtime", now: now, want: time.Date(2024, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{name: "downtime right now", when: "downtime", now: now.Add(time.Hour), want: time.Date(2024, 1, 6, 11, 0, 0, 0, time.UTC)},
+		{name: "downtime tomorrow", when: "downtime", now: now.Add(5 * time.Hour), want: time.Date(2024, 1, 6, 11, 0, 0, 0, time.UTC)},
+		{name: "downtime from another zone", when: "downtime", now: now.In(time.FixedZone("UTC+12", 12*60*60)), want: time.Date(2024, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{name: "minutes", when: "90m", now: now, want: now.Add(90 * time.Minute)},
+		{name: "hours", when: "2h", now: now, want: now.Add(2 * time.Hour)},
+		{name: "negative duration", when: "-2h", now: now, wantErr: "Don't know when"},
+		{name: "zero duration", when: "0s", now: now, wantErr: "Don't know when"},
+		{name: "minute", when: "2024-01-06T15:04", now: now, want: time.Date(2024, 1, 6, 15, 4, 0, 0, time.UTC)},
+		{name: "day", when: "2024-01-06", now: now, want: time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339", when: "2024-01-06T15:04:05+01:00", now: now, want: time.Date(2024, 1, 6, 14, 4, 5, 0, time.UTC)},
+		{name: "past day", when: "2024-01-04", now: now, wantErr: "in the past"},
+		{name: "earlier today", when: "2024-01-05T09:59", now: now, wantErr: "in the past"},
+		{name: "now", when: "2024-01-05T10:00", now: now, wantErr: "in the past"},
+		{name: "nonsense", when: "soon", now: now, wantErr: "Don't know when"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseWhen(test.when, test.now)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseWhen(%q) error = %v, want one containing %q", test.when, err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseWhen(%q) unexpected error: %v", test.when, err)
+			}
+
+			if !got.Equal(test.want) {
+				t.Errorf("parseWhen(%q) = %s, want %s", test.when, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package command
+
+import (
+	pclient "github.com/chremoas/perms-srv/client"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// permissions is a pclient.Permissions that also honours the channel scopes
+// perms-cmd keeps for individual grants, the windows groups are active in and
+// the groups that include others.
+type permissions struct {
+	*pclient.Permissions
+}
+
+func newPermission(client permsrv.PermissionsService, permissionsList []string) *permissions {
+	return &permissions{pclient.NewPermission(client, permissionsList)}
+}
+
+func (p permissions) CanPerform(ctx context.Context, sender string) (bool, error) {
+	canPerform, err := p.Permissions.CanPerform(ctx, sender)
+	if err != nil {
+		return false, err
+	}
+
+	s := strings.Split(sender, ":")
+	channel, user := s[0], s[1]
+
+	var restricted, inherits bool
+	store.view(func(st *state) {
+		for _, users := range st.Scopes {
+			if _, ok := users[user]; ok {
+				restricted = true
+			}
+		}
+
+		for _, group := range p.PermissionsList {
+			if _, ok := st.Windows[group]; ok {
+				restricted = true
+			}
+		}
+
+		for _, info := range st.Groups {
+			if len(info.Includes) > 0 {
+				inherits = true
+			}
+		}
+	})
+
+	if canPerform && !restricted {
+		return true, nil
+	}
+
+	if !canPerform && !inherits {
+		return false, nil
+	}
+
+	// Find a group, held directly or through another, that lets them do it from this channel, right now
+	groups, err := effectiveGroups(ctx, user, channel)
+	if err != nil {
+		return false, err
+	}
+
+	for _, allowed := range p.PermissionsList {
+		if _, ok := groups[allowed]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// inScope reports whether user's grant of group applies in channel.
+func inScope(group, user, channel string) bool {
+	var channels []string
+	var scoped bool
+	store.view(func(st *state) {
+		channels, scoped = st.Scopes[group][user]
+	})
+
+	if !scoped {
+		return true
+	}
+
+	for _, c := range channels {
+		if c == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setScope limits user's grant of group to channels, or lifts the limit when channels is empty.
+func setScope(group, user string, channels []string) error {
+	return store.update(func(st *state) {
+		if len(channels) == 0 {
+			delete(st.Scopes[group], user)
+			if len(st.Scopes[group]) == 0 {
+				delete(st.Scopes, group)
+			}
+			return
+		}
+
+		if st.Scopes[group] == nil {
+			st.Scopes[group] = make(map[string][]string)
+		}
+		st.Scopes[group][user] = channels
+	})
+}
+
+func scopeOf(group, user string) []string {
+	var channels []string
+	store.view(func(st *state) {
+		channels = st.Scopes[group][user]
+	})
+
+	return channels
+}
+
+// extractChannelId turns a channel mention like <#1234> into its id.
+func extractChannelId(channel string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(channel, "<#"), ">")
+}
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"golang.org/x/net/context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanPerformScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		sender  string
+		want    bool
+	}{
+		{name: "unscoped member", allowed: []string{"fc_tools"}, sender: "anywhere:2", want: true},
+		{name: "scoped member in scope", allowed: []string{"fc_tools"}, sender: "ops:1", want: true},
+		{name: "scoped member in another scope", allowed: []string{"fc_tools"}, sender: "fleet:1", want: true},
+		{name: "scoped member out of scope", allowed: []string{"fc_tools"}, sender: "general:1", want: false},
+		{name: "non member", allowed: []string{"fc_tools"}, sender: "ops:3", want: false},
+		{name: "another group in any channel", allowed: []string{"fc_tools", "scouts"}, sender: "general:1", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestState(t)
+			useFakePerms(t, map[string][]string{"fc_tools": {"1", "2"}, "scouts": {"1"}})
+			if err := setScope("fc_tools", "1", []string{"ops", "fleet"}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := newPermission(clientFactory.NewPermsClient(), test.allowed).CanPerform(context.Background(), test.sender)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("CanPerform(%q) with %q = %t, want %t", test.sender, test.allowed, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCanPerformWindows(t *testing.T) {
+	now := time.Now().UTC()
+	open, err := parseWindow("*", "00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := parseWindow(strings.ToLower(now.AddDate(0, 0, 2).Weekday().String()[:3]), "00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		windows map[string]window
+		allowed []string
+		want    bool
+	}{
+		{name: "no window", allowed: []string{"fc_tools"}, want: true},
+		{name: "open window", windows: map[string]window{"fc_tools": open}, allowed: []string{"fc_tools"}, want: true},
+		{name: "closed window", windows: map[string]window{"fc_tools": closed}, allowed: []string{"fc_tools"}, want: false},
+		{name: "closed window on another group", windows: map[string]window{"scouts": closed}, allowed: []string{"fc_tools"}, want: true},
+		{name: "another group open", windows: map[string]window{"fc_tools": closed}, allowed: []string{"fc_tools", "scouts"}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestState(t)
+			useFakePerms(t, map[string][]string{"fc_tools": {"1"}, "scouts": {"1"}})
+			err := store.update(func(st *state) {
+				for group, w := range test.windows {
+					w.Group = group
+					st.Windows[group] = w
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := newPermission(clientFactory.NewPermsClient(), test.allowed).CanPerform(context.Background(), "ops:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("CanPerform with %q = %t, want %t", test.allowed, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package command
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings holds the perms-cmd options read from the extensions.perms section
+// of the configuration file. Each capability is granted to members of any of
+// the listed permission groups.
+type Settings struct {
+	Auditors        []string `json:"auditors"`
+	Create          []string `json:"create"`
+	Destroy         []string `json:"destroy"`
+	Membership      []string `json:"membership"`
+	ProtectedGroups []string `json:"protectedGroups"`
+	AdminChannels   []string `json:"adminChannels"`
+	StateFile       string   `json:"stateFile"`
+
+	// SelfModification is what happens when an admin changes their own
+	// membership of a protected group: allow, deny or approve
+	SelfModification string `json:"selfModification"`
+
+	// TwoPersonRule makes changes to protected groups, and any destroy, wait
+	// for a second admin to approve them within ApprovalWindow
+	TwoPersonRule  bool   `json:"twoPersonRule"`
+	ApprovalWindow string `json:"approvalWindow"`
+
+	// ConfirmWindow is how long the sender has to confirm a destructive change
+	ConfirmWindow string `json:"confirmWindow"`
+
+	// ExpiryNotice is how long before a temporary group expires its members are told
+	ExpiryNotice string `json:"expiryNotice"`
+
+	// Commands maps "<command> <subcommand>", or just "<command>", to the
+	// groups allowed to run it, overriding what services register themselves
+	Commands map[string][]string `json:"commands"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Auditors:         []string{"perms_auditors"},
+		Create:           []string{"perms_admins"},
+		Destroy:          []string{"perms_admins"},
+		Membership:       []string{"perms_admins"},
+		ProtectedGroups:  []string{"perms_admins", "server_admins"},
+		StateFile:        "/etc/chremoas/perms-cmd.json",
+		SelfModification: "allow",
+		ApprovalWindow:   "1h",
+		ConfirmWindow:    "5m",
+		ExpiryNotice:     "24h",
+	}
+}
+
+func (s Settings) validate() error {
+	if _, err := time.ParseDuration(s.ApprovalWindow); err != nil {
+		return fmt.Errorf("invalid approvalWindow: %v", err)
+	}
+
+	if _, err := time.ParseDuration(s.ConfirmWindow); err != nil {
+		return fmt.Errorf("invalid confirmWindow: %v", err)
+	}
+
+	if _, err := time.ParseDuration(s.ExpiryNotice); err != nil {
+		return fmt.Errorf("invalid expiryNotice: %v", err)
+	}
+
+	return nil
+}
+
+func (s Settings) approvalWindow() time.Duration {
+	d, _ := time.ParseDuration(s.ApprovalWindow)
+	return d
+}
+
+func (s Settings) confirmWindow() time.Duration {
+	d, _ := time.ParseDuration(s.ConfirmWindow)
+	return d
+}
+
+func (s Settings) expiryNotice() time.Duration {
+	d, _ := time.ParseDuration(s.ExpiryNotice)
+	return d
+}
+
+// readers are the groups allowed to see protected groups and reports: the
+// auditors plus anybody holding an administrative capability.
+func (s Settings) readers() []string {
+	var groups []string
+	seen := make(map[string]bool)
+
+	for _, list := range [][]string{s.Create, s.Destroy, s.Membership, s.Auditors} {
+		for _, g := range list {
+			if !seen[g] {
+				seen[g] = true
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,129 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// state is everything perms-cmd keeps about permission groups that perms-srv doesn't.
+type state struct {
+	// Scopes limits a user's grant of a group to a set of channels: group -> user -> channels
+	Scopes map[string]map[string][]string `json:"scopes"`
+
+	// Pending are changes waiting on a confirmation, keyed by their id
+	Pending map[string]pendingChange `json:"pending"`
+
+	// Destroyed remembers destroyed groups so they can be restored, keyed by name
+	Destroyed map[string]operation `json:"destroyed"`
+
+	// Audit is every change made through perms-cmd, oldest first
+	Audit []auditEntry `json:"audit"`
+
+	// Scheduled are changes waiting for their time to come, keyed by their id
+	Scheduled map[string]scheduledChange `json:"scheduled"`
+
+	// Rotations are groups whose membership rotates through a roster, keyed by group
+	Rotations map[string]rotation `json:"rotations"`
+
+	// Windows limit when groups are active, keyed by group
+	Windows map[string]window `json:"windows"`
+
+	// Groups is what perms-cmd knows about a group beyond its description, keyed by group
+	Groups map[string]groupInfo `json:"groups"`
+
+	// Notices are messages waiting to be shown to a user the next time they use perms-cmd
+	Notices map[string][]string `json:"notices"`
+
+	// Links are groups whose membership follows a role-srv filter or role, keyed by group
+	Links map[string]link `json:"links"`
+}
+
+// stateStore guards the state and keeps a copy of it on disk so it survives restarts.
+type stateStore struct {
+	mutex sync.Mutex
+	path  string
+	state state
+}
+
+var store *stateStore
+
+func loadState(path string) (*stateStore, error) {
+	s := &stateStore{path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &s.state); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.state.Scopes == nil {
+		s.state.Scopes = make(map[string]map[string][]string)
+	}
+
+	if s.state.Pending == nil {
+		s.state.Pending = make(map[string]pendingChange)
+	}
+
+	if s.state.Destroyed == nil {
+		s.state.Destroyed = make(map[string]operation)
+	}
+
+	if s.state.Scheduled == nil {
+		s.state.Scheduled = make(map[string]scheduledChange)
+	}
+
+	if s.state.Rotations == nil {
+		s.state.Rotations = make(map[string]rotation)
+	}
+
+	if s.state.Windows == nil {
+		s.state.Windows = make(map[string]window)
+	}
+
+	if s.state.Groups == nil {
+		s.state.Groups = make(map[string]groupInfo)
+	}
+
+	if s.state.Notices == nil {
+		s.state.Notices = make(map[string][]string)
+	}
+
+	if s.state.Links == nil {
+		s.state.Links = make(map[string]link)
+	}
+
+	return s, nil
+}
+
+// view calls f with the state locked.
+func (s *stateStore) view(f func(st *state)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f(&s.state)
+}
+
+// update calls f with the state locked and writes the result to disk.
+func (s *stateStore) update(f func(st *state)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f(&s.state)
+
+	b, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
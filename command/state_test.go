@@ -0,0 +1,27 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestState points store at an empty state file, and settings at the
+// defaults, for the length of the test.
+func useTestState(t *testing.T) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "perms-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s, err := loadState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, settings = s, DefaultSettings()
+}
@@ -0,0 +1,367 @@
+package command
+
+import (
+	"fmt"
+	proto "github.com/chremoas/chremoas/proto"
+	permsrv "github.com/chremoas/perms-srv/proto"
+	common "github.com/chremoas/services-common/command"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+	"time"
+)
+
+const windowUsage = "Usage: !perms window <group> [<days> <HH:MM-HH:MM>|off], e.g. sat,sun 18:00-23:00 or mon-fri 19:00-02:00 (UTC)"
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// window is when a group grants anything. Outside it the members are taken
+// out of the group and kept in Stashed until it opens again.
+type window struct {
+	Group   string              `json:"group"`
+	Spec    string              `json:"spec"`
+	Days    [7]bool             `json:"days"`
+	Start   int                 `json:"start"`
+	End     int                 `json:"end"`
+	Closed  bool                `json:"closed"`
+	Stashed map[string][]string `json:"stashed,omitempty"`
+}
+
+// parseWindow reads specs like "sat,sun 18:00-23:00", "* 19:00-21:00" or "mon-fri 22:00-02:00".
+func parseWindow(days, hours string) (window, error) {
+	w := window{Spec: days + " " + hours}
+
+	for _, part := range strings.Split(strings.ToLower(days), ",") {
+		if part == "*" {
+			w.Days = [7]bool{true, true, true, true, true, true, true}
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		first, last := weekday(bounds[0]), weekday(bounds[len(bounds)-1])
+		if first < 0 || last < 0 {
+			return w, fmt.Errorf("Unknown day in '%s'", part)
+		}
+
+		for d := first; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	bounds := strings.SplitN(hours, "-", 2)
+	if len(bounds) != 2 {
+		return w, fmt.Errorf("Hours look like 18:00-23:00")
+	}
+
+	var err error
+	if w.Start, err = minuteOfDay(bounds[0]); err != nil {
+		return w, err
+	}
+
+	if w.End, err = minuteOfDay(bounds[1]); err != nil {
+		return w, err
+	}
+
+	if w.Start == w.End {
+		return w, fmt.Errorf("A window can't start and end at the same time")
+	}
+
+	return w, nil
+}
+
+func weekday(day string) int {
+	for i, d := range weekdays {
+		if d == day {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func minuteOfDay(hhmm string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(hhmm, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("'%s' isn't a time like 18:00", hhmm)
+	}
+
+	return h*60 + m, nil
+}
+
+// open reports whether the window is open at t.
+func (w window) open(t time.Time) bool {
+	t = t.UTC()
+	day, minute := int(t.Weekday()), t.Hour()*60+t.Minute()
+
+	if w.Start < w.End {
+		return w.Days[day] && minute >= w.Start && minute < w.End
+	}
+
+	// The window runs past midnight into the next day
+	return (w.Days[day] && minute >= w.Start) || (w.Days[(day+6)%7] && minute < w.End)
+}
+
+// windowOpen reports whether group currently grants anything.
+func windowOpen(group string) bool {
+	var w window
+	var ok bool
+	store.view(func(st *state) {
+		w, ok = st.Windows[group]
+	})
+
+	return !ok || w.open(time.Now())
+}
+
+// stashed returns the channels user's membership of group was scoped to, when
+// it's being held back until group's window opens.
+func stashed(group, user string) ([]string, bool) {
+	var channels []string
+	var ok bool
+	store.view(func(st *state) {
+		channels, ok = st.Windows[group].Stashed[user]
+	})
+
+	return channels, ok
+}
+
+// stashedUsers returns the members of group held back until its window opens.
+func stashedUsers(group string) []string {
+	var users []string
+	store.view(func(st *state) {
+		for user := range st.Windows[group].Stashed {
+			users = append(users, user)
+		}
+	})
+
+	sort.Strings(users)
+	return users
+}
+
+// stashedGroups returns the groups user is held out of until their windows open.
+func stashedGroups(user string) []string {
+	var groups []string
+	store.view(func(st *state) {
+		for group, w := range st.Windows {
+			if _, ok := w.Stashed[user]; ok {
+				groups = append(groups, group)
+			}
+		}
+	})
+
+	sort.Strings(groups)
+	return groups
+}
+
+// memberChannels returns the channels user's membership of group is scoped
+// to, whether it's in perms-srv or held back by a closed window.
+func memberChannels(group, user string) []string {
+	if channels, ok := stashed(group, user); ok {
+		return channels
+	}
+
+	return scopeOf(group, user)
+}
+
+// unstash forgets user's held back membership of group, so the window
+// opening doesn't give it back, and reports whether there was one.
+func unstash(group, user string) (bool, error) {
+	if _, ok := stashed(group, user); !ok {
+		return false, nil
+	}
+
+	return true, store.update(func(st *state) {
+		if w, ok := st.Windows[group]; ok {
+			delete(w.Stashed, user)
+			st.Windows[group] = w
+		}
+	})
+}
+
+func setWindow(ctx context.Context, req *proto.ExecRequest) string {
+	if len(req.Args) < 3 || len(req.Args) > 5 {
+		return common.SendError(windowUsage)
+	}
+
+	group := req.Args[2]
+
+	var w window
+	var ok bool
+	store.view(func(st *state) {
+		w, ok = st.Windows[group]
+	})
+
+	if len(req.Args) == 3 {
+		if !ok {
+			return common.SendSuccess(fmt.Sprintf("'%s' is always active\n", group))
+		}
+
+		if w.open(time.Now()) {
+			return common.SendSuccess(fmt.Sprintf("'%s' is active %s UTC and is open now\n", group, w.Spec))
+		}
+
+		return common.SendSuccess(fmt.Sprintf("'%s' is active %s UTC and is closed now, holding %d members\n",
+			group, w.Spec, len(w.Stashed)))
+	}
+
+	if msg := checkChannel(req.Sender); msg != "" {
+		return msg
+	}
+
+	// Closing a window takes everybody out of the group, so it's guarded like removing them
+	if group == "perms_admins" {
+		if msg := checkPermission(ctx, req.Sender, serverPerms); msg != "" {
+			return msg
+		}
+	}
+
+	if msg := checkPermission(ctx, req.Sender, membershipPerms); msg != "" {
+		return msg
+	}
+
+	if settings.TwoPersonRule && !isConfirmed(ctx) && isProtected(group) {
+		return requestApproval(ctx, req, fmt.Sprintf("Changes to '%s' need approval", group))
+	}
+
+	if isDryRun(ctx) {
+		return common.SendSuccess(fmt.Sprintf("The window on '%s' would be changed\n", group))
+	}
+
+	if len(req.Args) == 4 {
+		if req.Args[3] != "off" {
+			return common.SendError(windowUsage)
+		}
+
+		if !ok {
+			return common.SendError(fmt.Sprintf("'%s' doesn't have a window", group))
+		}
+
+		// Put back anybody the window is holding before forgetting about it
+		if err := openWindow(ctx, w); err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		err := store.update(func(st *state) {
+			delete(st.Windows, group)
+		})
+		if err != nil {
+			return common.SendFatal(err.Error())
+		}
+
+		return common.SendSuccess(fmt.Sprintf("'%s' is always active again\n", group))
+	}
+
+	perm, err := findPermission(ctx, group)
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	if perm == nil {
+		return common.SendError(fmt.Sprintf("'%s' doesn't exist", group))
+	}
+
+	spec, err := parseWindow(req.Args[3], req.Args[4])
+	if err != nil {
+		return common.SendError(err.Error())
+	}
+
+	spec.Group = group
+	spec.Closed, spec.Stashed = w.Closed, w.Stashed
+	err = store.update(func(st *state) {
+		st.Windows[group] = spec
+	})
+	if err != nil {
+		return common.SendFatal(err.Error())
+	}
+
+	return common.SendSuccess(fmt.Sprintf("'%s' is now only active %s UTC\n", group, spec.Spec))
+}
+
+// openWindow gives the members held while w was closed their membership back.
+func openWindow(ctx context.Context, w window) error {
+	var changes []operation
+	for user, channels := range w.Stashed {
+		changes = append(changes, operation{Action: "add", Group: w.Group, User: user, Channels: channels})
+	}
+
+	if len(changes) > 0 {
+		req := &proto.ExecRequest{Sender: systemSender, Args: []string{cmdName, "window", w.Group, "open"}}
+		if _, err := applyChanges(ctx, req, changes, 0); err != nil {
+			return err
+		}
+	}
+
+	return store.update(func(st *state) {
+		if current, ok := st.Windows[w.Group]; ok {
+			current.Closed, current.Stashed = false, nil
+			st.Windows[w.Group] = current
+		}
+	})
+}
+
+// closeWindow takes everybody out of w's group, holding on to them until it opens again.
+func closeWindow(ctx context.Context, w window) error {
+	users, err := clientFactory.NewPermsClient().ListPermissionUsers(ctx, &permsrv.UsersRequest{Permission: w.Group})
+	if err != nil {
+		return err
+	}
+
+	if w.Closed && len(users.UserList) == 0 {
+		return nil
+	}
+
+	var changes []operation
+	for _, user := range users.UserList {
+		changes = append(changes, operation{Action: "remove", Group: w.Group, User: user, Channels: scopeOf(w.Group, user)})
+	}
+
+	if len(changes) > 0 {
+		req := &proto.ExecRequest{Sender: systemSender, Args: []string{cmdName, "window", w.Group, "close"}}
+		if _, err := applyChanges(ctx, req, changes, 0); err != nil {
+			return err
+		}
+	}
+
+	return store.update(func(st *state) {
+		if current, ok := st.Windows[w.Group]; ok {
+			current.Closed = true
+			if current.Stashed == nil {
+				current.Stashed = make(map[string][]string)
+			}
+			for _, change := range changes {
+				current.Stashed[change.User] = change.Channels
+			}
+			st.Windows[w.Group] = current
+		}
+	})
+}
+
+// runWindows keeps perms-srv in line with the group windows, so that other
+// services' Perform calls agree with ours. Anybody added while a window is
+// closed is held back as well.
+func runWindows(ctx context.Context) {
+	var windows []window
+	store.view(func(st *state) {
+		for _, w := range st.Windows {
+			windows = append(windows, w)
+		}
+	})
+
+	for _, w := range windows {
+		var err error
+		if w.open(time.Now()) {
+			if w.Closed {
+				err = openWindow(ctx, w)
+			}
+		} else {
+			err = closeWindow(ctx, w)
+		}
+
+		if err != nil {
+			logger.Error("Unable to apply window", zap.String("group", w.Group), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    string
+		hours   string
+		want    [7]bool
+		start   int
+		end     int
+		wantErr string
+	}{
+		{name: "list", days: "sat,sun", hours: "18:00-23:00", want: [7]bool{true, false, false, false, false, false, true}, start: 18 * 60, end: 23 * 60},
+		{name: "every day", days: "*", hours: "19:00-21:30", want: [7]bool{true, true, true, true, true, true, true}, start: 19 * 60, end: 21*60 + 30},
+		{name: "range", days: "mon-fri", hours: "09:00-17:00", want: [7]bool{false, true, true, true, true, true, false}, start: 9 * 60, end: 17 * 60},
+		{name: "range over the weekend", days: "fri-mon", hours: "22:00-02:00", want: [7]bool{true, true, false, false, false, true, true}, start: 22 * 60, end: 2 * 60},
+		{name: "upper case", days: "SAT", hours: "18:00-24:00", want: [7]bool{false, false, false, false, false, false, true}, start: 18 * 60, end: 24 * 60},
+		{name: "unknown day", days: "someday", hours: "18:00-23:00", wantErr: "Unknown day"},
+		{name: "no end", days: "sat", hours: "18:00", wantErr: "Hours look like"},
+		{name: "past 24:00", days: "sat", hours: "18:00-24:01", wantErr: "isn't a time"},
+		{name: "bad minutes", days: "sat", hours: "18:60-23:00", wantErr: "isn't a time"},
+		{name: "empty", days: "sat", hours: "18:00-18:00", wantErr: "same time"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, err := parseWindow(test.days, test.hours)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if w.Days != test.want || w.Start != test.start || w.End != test.end {
+				t.Errorf("got days %v %d-%d, want %v %d-%d", w.Days, w.Start, w.End, test.want, test.start, test.end)
+			}
+		})
+	}
+}
+
+func TestWindowOpen(t *testing.T) {
+	// 2024-01-05 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		days  string
+		hours string
+		at    time.Time
+		want  bool
+	}{
+		{name: "inside", days: "sat,sun", hours: "18:00-23:00", at: at(6, 20, 0), want: true},
+		{name: "at the start", days: "sat,sun", hours: "18:00-23:00", at: at(6, 18, 0), want: true},
+		{name: "at the end", days: "sat,sun", hours: "18:00-23:00", at: at(6, 23, 0), want: false},
+		{name: "wrong day", days: "sat,sun", hours: "18:00-23:00", at: at(5, 20, 0), want: false},
+		{name: "before midnight", days: "fri", hours: "22:00-02:00", at: at(5, 23, 30), want: true},
+		{name: "after midnight", days: "fri", hours: "22:00-02:00", at: at(6, 1, 59), want: true},
+		{name: "after the wrap", days: "fri", hours: "22:00-02:00", at: at(6, 2, 0), want: false},
+		{name: "early on the day it starts", days: "fri", hours: "22:00-02:00", at: at(5, 1, 0), want: false},
+		{name: "late on the day after", days: "fri", hours: "22:00-02:00", at: at(6, 23, 0), want: false},
+		{name: "weekend range sunday", days: "fri-mon", hours: "10:00-12:00", at: at(7, 11, 0), want: true},
+		{name: "weekend range monday", days: "fri-mon", hours: "10:00-12:00", at: at(8, 11, 0), want: true},
+		{name: "weekend range tuesday", days: "fri-mon", hours: "10:00-12:00", at: at(9, 11, 0), want: false},
+		{name: "wrap out of the range", days: "fri-mon", hours: "22:00-02:00", at: at(9, 1, 0), want: true},
+		{name: "wrap past the range", days: "fri-mon", hours: "22:00-02:00", at: at(10, 1, 0), want: false},
+		{name: "until 24:00", days: "fri", hours: "18:00-24:00", at: at(5, 23, 59), want: true},
+		{name: "24:00 is midnight", days: "fri", hours: "18:00-24:00", at: at(6, 0, 0), want: false},
+		{name: "other zones are converted", days: "fri", hours: "18:00-23:00", at: at(5, 20, 0).In(time.FixedZone("UTC+6", 6*60*60)), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, err := parseWindow(test.days, test.hours)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := w.open(test.at); got != test.want {
+				t.Errorf("%s %s open at %s = %t, want %t", test.days, test.hours, test.at.Format(time.RFC1123), got, test.want)
+			}
+		})
+	}
+}
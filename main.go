@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	proto "github.com/chremoas/chremoas/proto"
 	permsvc "github.com/chremoas/perms-srv/proto"
@@ -10,6 +12,7 @@ import (
 	chremoasPrometheus "github.com/chremoas/services-common/prometheus"
 	"github.com/micro/go-micro"
 	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/registry"
 	"go.uber.org/zap"
 
 	"github.com/chremoas/perms-cmd/command"
@@ -47,20 +50,79 @@ func initialize(config *config.Configuration) error {
 	clientFactory := clientFactory{
 		permsSrv: config.LookupService("srv", "perms"),
 		roleSrv:  config.LookupService("srv", "role"),
+		lookup:   config.LookupService,
 		client:   service.Client()}
 
-	proto.RegisterCommandHandler(service.Server(),
-		command.NewCommand(name,
-			&clientFactory,
-		),
-	)
+	settings, err := loadSettings(config)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := command.NewCommand(name, &clientFactory, settings, logger)
+	if err != nil {
+		return err
+	}
+
+	proto.RegisterCommandHandler(service.Server(), cmd)
+
+	// Lets other services ask about permissions with includes, scopes and windows applied
+	server := service.Server()
+	if err = server.Handle(server.NewHandler(&command.EffectivePermissions{})); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// loadSettings reads our options out of the extensions.perms section of the config
+func loadSettings(config *config.Configuration) (command.Settings, error) {
+	settings := command.DefaultSettings()
+
+	extension, ok := config.Extensions[name]
+	if !ok {
+		return settings, nil
+	}
+
+	// The extensions are decoded generically, so round trip them through json
+	b, err := json.Marshal(stringKeys(extension))
+	if err != nil {
+		return settings, err
+	}
+
+	if err = json.Unmarshal(b, &settings); err != nil {
+		return settings, fmt.Errorf("unable to decode extensions.%s: %v", name, err)
+	}
+
+	return settings, nil
+}
+
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, val := range v {
+			m[fmt.Sprint(key)] = stringKeys(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, val := range v {
+			m[key] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeys(v[i])
+		}
+	}
+
+	return value
+}
+
 type clientFactory struct {
 	permsSrv string
 	roleSrv  string
+	lookup   func(serviceType, serviceName string) string
 	client   client.Client
 }
 
@@ -71,3 +133,44 @@ func (c clientFactory) NewPermsClient() permsvc.PermissionsService {
 func (c clientFactory) NewRolesClient() rolesrv.RolesService {
 	return rolesrv.NewRolesService(c.roleSrv, c.client)
 }
+
+func (c clientFactory) CommandMetadata(command string) (map[string]string, error) {
+	metadata := make(map[string]string)
+
+	services, err := c.client.Options().Registry.GetService(c.lookup("cmd", command))
+	if err == registry.ErrNotFound {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range services {
+		for _, node := range s.Nodes {
+			for key, value := range node.Metadata {
+				metadata[key] = value
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+func (c clientFactory) ListCommands() ([]string, error) {
+	services, err := c.client.Options().Registry.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	seen := make(map[string]bool)
+	prefix := c.lookup("cmd", "")
+	for _, s := range services {
+		if command := strings.TrimPrefix(s.Name, prefix); command != s.Name && !seen[command] {
+			seen[command] = true
+			commands = append(commands, command)
+		}
+	}
+
+	return commands, nil
+}